@@ -0,0 +1,50 @@
+//go:build linux
+
+package assertServices
+
+import (
+    "time"
+    "github.com/spf13/cobra"
+    "github.com/monobilisim/monokit/common"
+)
+
+type AssertServices struct {
+    Services []string
+}
+
+var AssertServicesConfig AssertServices
+
+// CheckServices alarms for each of the configured systemd units that is
+// missing or not active
+func CheckServices() {
+    for _, service := range AssertServicesConfig.Services {
+        name := "svc_" + service
+
+        if !common.SystemdUnitExists(service) {
+            common.PrettyPrintStr(service, false, "installed")
+            common.AlarmCheckDown(name, "Service " + service + " is not installed", false)
+            continue
+        }
+
+        if !common.SystemdUnitActive(service) {
+            common.PrettyPrintStr(service, false, "active")
+            common.AlarmCheckDown(name, "Service " + service + " is not active", false)
+        } else {
+            common.PrettyPrintStr(service, true, "active")
+            common.AlarmCheckUp(name, "Service " + service + " is now active", false)
+        }
+    }
+}
+
+func Main(cmd *cobra.Command, args []string) {
+    version := "0.1.0"
+    common.ScriptName = "assertServices"
+    common.TmpDir = common.TmpBaseDir + "assertServices"
+    common.Init()
+    common.ConfInit("services", &AssertServicesConfig)
+
+    common.Println("Assert Services - v" + version + " - " + common.FormatTime(time.Now()))
+
+    common.SplitSection("Services")
+    CheckServices()
+}
@@ -0,0 +1,118 @@
+package commandCheck
+
+import (
+    "fmt"
+    "time"
+    "errors"
+    "regexp"
+    "context"
+    "os/exec"
+    "strings"
+    "github.com/spf13/cobra"
+    "github.com/monobilisim/monokit/common"
+    issues "github.com/monobilisim/monokit/common/redmine/issues"
+)
+
+type Check struct {
+    Name string
+    Command string
+    Args []string
+    Timeout float64 // Seconds
+    Expect_Exit int
+    Expect_Output string // Regex the stdout has to match
+}
+
+type CommandCheck struct {
+    Checks []Check
+}
+
+var CommandCheckConfig CommandCheck
+
+// runCheck runs the command of the check and returns why it doesn't meet
+// the expectations, or an empty string if it does
+func runCheck(check Check) string {
+    timeout := check.Timeout
+    if timeout == 0 {
+        timeout = 30
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout * float64(time.Second)))
+    defer cancel()
+
+    stdout, stderr, err := common.Runner.Run(ctx, check.Command, check.Args...)
+
+    if ctx.Err() == context.DeadlineExceeded {
+        return "timed out after " + fmt.Sprint(timeout) + " seconds"
+    }
+
+    // The exit code still counts, the output is checked as far as it goes
+    if common.OutputTruncated(err) {
+        err = errors.Unwrap(err)
+    }
+
+    exitCode := 0
+    if err != nil {
+        var exitErr *exec.ExitError
+        if !errors.As(err, &exitErr) {
+            return "couldn't be run: " + err.Error()
+        }
+        exitCode = exitErr.ExitCode()
+    }
+
+    if exitCode != check.Expect_Exit {
+        reason := "exited with " + fmt.Sprint(exitCode) + " instead of " + fmt.Sprint(check.Expect_Exit)
+        if output := strings.TrimSpace(stderr + stdout); output != "" {
+            reason += ": " + output
+        }
+        return reason
+    }
+
+    if check.Expect_Output != "" {
+        re, err := regexp.Compile(check.Expect_Output)
+        if err != nil {
+            return "has an invalid expect_output: " + err.Error()
+        }
+
+        if !re.MatchString(stdout) {
+            return "output doesn't match '" + check.Expect_Output + "': " + strings.TrimSpace(stdout)
+        }
+    }
+
+    return ""
+}
+
+// CheckCommands runs the configured checks, alarming and opening an issue
+// for each one not meeting its expectations
+func CheckCommands() {
+    for _, check := range CommandCheckConfig.Checks {
+        if check.Name == "" || check.Command == "" {
+            common.LogError("Skipping a check without a name or command")
+            continue
+        }
+
+        service := "command_" + check.Name
+
+        if reason := runCheck(check); reason != "" {
+            common.PrettyPrintStr(check.Name, false, "passing")
+            common.AlarmCheckDown(service, "Check " + check.Name + " failed, " + check.Command + " " + reason, false)
+            issues.CheckDown(service, common.Config.Identifier + " için " + check.Name + " kontrolü başarısız", check.Command + " " + reason, false, 0)
+        } else {
+            common.PrettyPrintStr(check.Name, true, "passing")
+            common.AlarmCheckUp(service, "Check " + check.Name + " is passing again", false)
+            issues.CheckUp(service, check.Name + " kontrolü tekrar başarılı.")
+        }
+    }
+}
+
+func Main(cmd *cobra.Command, args []string) {
+    version := "0.1.0"
+    common.ScriptName = "commandCheck"
+    common.TmpDir = common.TmpBaseDir + "commandCheck"
+    common.Init()
+    common.ConfInit("commands", &CommandCheckConfig)
+
+    common.Println("Command Check - v" + version + " - " + common.FormatTime(time.Now()))
+
+    common.SplitSection("Checks")
+    CheckCommands()
+}
@@ -7,11 +7,17 @@ import (
     "encoding/json"
     "io"
     "os"
+    "sync"
+    "errors"
+    "strconv"
     "strings"
     "github.com/spf13/cobra"
 )
 
-var TmpDir = "/tmp/mono/"
+// TmpBaseDir holds a state directory for each component
+const TmpBaseDir = "/tmp/mono/"
+
+var TmpDir = TmpBaseDir
 var ScriptName string
 
 var AlarmCmd = &cobra.Command{
@@ -42,6 +48,8 @@ var AlarmCheckDownCmd = &cobra.Command{
         ScriptName, _ = cmd.Flags().GetString("scriptName")
         noInterval, _ := cmd.Flags().GetBool("noInterval")
         AlarmCheckDown(service, message, noInterval)
+        // Sending the alarm succeeded, the down service isn't this command's health
+        exitCode = ExitHealthy
     },
 }
 
@@ -55,11 +63,44 @@ var AlarmSendCmd = &cobra.Command{
     },
 }
 
+// alarmRoute returns the stream and topic of the route with the longest
+// prefix matching service, or empty strings for the default route.
+func alarmRoute(service string) (string, string) {
+    var stream, topic string
+    longest := -1
+
+    // viper lowercases map keys
+    service = strings.ToLower(service)
+
+    for prefix, route := range Config.Alarm.Routes {
+        if strings.HasPrefix(service, prefix) && len(prefix) > longest {
+            longest = len(prefix)
+            stream = route.Stream
+            topic = route.Topic
+        }
+    }
+
+    return stream, topic
+}
+
 func AlarmCheckUp(service string, message string, noInterval bool) {
     // Remove slashes from service and replace them with -
     serviceReplaced := strings.Replace(service, "/", "-", -1)
     file_path := TmpDir + "/" + serviceReplaced + ".log"
+    message = withIncident(message, currentIncidentID(service))
     messageFinal := "[" + ScriptName + " - " + Config.Identifier + "] [:check:] " + message
+    stream, topic := alarmRoute(service)
+
+    // Whether a down alarm was sent is unknown without state
+    if StateDegraded {
+        return
+    }
+
+    // The service was down if its file exists
+    flapping := flapCheck(service, FileExists(file_path), "up")
+    quiet := flapping || QuietFirstRun
+
+    alarmEscalationClear(service, message, quiet)
     
     if _, err := os.Stat(file_path); os.IsNotExist(err) {
         return
@@ -89,28 +130,79 @@ func AlarmCheckUp(service string, message string, noInterval bool) {
         return
     }
 
-    if j.Locked == false && noInterval == false {
-        os.Remove(file_path)
-        return
-    } else {
-        os.Remove(file_path)
-        Alarm(messageFinal, "", "", false)
+    os.Remove(file_path)
+
+    // The Redmine issue of the incident may still be open, issues ends the
+    // incident once it is closed
+    if !FileExists(TmpDir + "/" + serviceReplaced + "-redmine.log") {
+        EndIncident(service)
+    }
+
+    // Only recover from a down alarm that was actually sent
+    if j.alerted() && !quiet {
+        Alarm(messageFinal, stream, topic, false)
     }
 }
 
+// RedmineStatSuffix is the suffix of the files issues keeps the down state
+// of a service in, written as a ServiceFile
+const RedmineStatSuffix = "-redmine-stat.log"
+
 type ServiceFile struct {
     Date string `json:"date"`
     Locked bool `json:"locked"`
+    // Whether the down alarm was sent, nil in the files written before it
+    // was recorded
+    Alerted *bool `json:"alerted,omitempty"`
+}
+
+// alerted reports whether the down alarm was sent. Locked is checked for
+// the files written before Alerted was recorded.
+func (j ServiceFile) alerted() bool {
+    if j.Alerted == nil {
+        return j.Locked
+    }
+    return *j.Alerted
 }
 
+func alertedPtr(alerted bool) *bool {
+    return &alerted
+}
 
 func AlarmCheckDown(service string, message string, noInterval bool) {
+    alarmCheckDown(service, message, noInterval, true)
+}
+
+// AlarmCheckDownAdvisory alarms like AlarmCheckDown, without raising the
+// exit code, for the services that don't affect the health of the host
+func AlarmCheckDownAdvisory(service string, message string, noInterval bool) {
+    alarmCheckDown(service, message, noInterval, false)
+}
+
+func alarmCheckDown(service string, message string, noInterval bool, degraded bool) {
     // Remove slashes from service and replace them with -
     serviceReplaced := strings.Replace(service, "/", "-", -1)
     filePath := TmpDir + "/" + serviceReplaced + ".log"
     currentDate := time.Now().Format("2006-01-02 15:04:05 -0700")
 
+    message = withIncident(message, IncidentID(service))
     messageFinal := "[" + ScriptName + " - " + Config.Identifier + "] [:red_circle:] " + message
+    stream, topic := alarmRoute(service)
+
+    if degraded {
+        SetExitCode(ExitDegraded)
+    }
+
+    if StateDegraded {
+        alarmDown(messageFinal, message, stream, topic)
+        return
+    }
+
+    // The service was up if its file doesn't exist
+    flapping := flapCheck(service, !FileExists(filePath), "down")
+    quiet := flapping || QuietFirstRun
+
+    alarmEscalate(service, message, quiet)
     
     // Check if the file exists
     if _, err := os.Stat(filePath); err == nil && noInterval == false {
@@ -154,19 +246,22 @@ func AlarmCheckDown(service string, message string, noInterval bool) {
         finJson := &ServiceFile{
                     Date: currentDate, 
                     Locked: true,
+                    Alerted: alertedPtr(!quiet),
                  }
         
         if Config.Alarm.Interval == 0 {
             if oldDateParsed.Format("2006-01-02") != time.Now().Format("2006-01-02") {
-                jsonData, err := json.Marshal(&ServiceFile{Date: currentDate, Locked: false})
+                jsonData, err := json.Marshal(&ServiceFile{Date: currentDate, Locked: false, Alerted: alertedPtr(j.alerted() || !quiet)})
 
                 if err != nil {
                     LogError("Error marshalling JSON: \n" + err.Error())
                 }
 
-                err = os.WriteFile(filePath, jsonData, 0644)
+                err = AtomicWriteFile(filePath, jsonData, 0644)
 
-                Alarm(messageFinal, "", "", false)
+                if !quiet {
+                    alarmDown(messageFinal, message, stream, topic)
+                }
             }
             return
         }
@@ -179,13 +274,15 @@ func AlarmCheckDown(service string, message string, noInterval bool) {
                 LogError("Error marshalling JSON: \n" + err.Error())
             }
 
-            err = os.WriteFile(filePath, jsonData, 0644)
+            err = AtomicWriteFile(filePath, jsonData, 0644)
 
             if err != nil {
                 LogError("Error writing to file: \n" + err.Error())
             }
             
-            Alarm(messageFinal, "", "", false)
+            if !quiet {
+                alarmDown(messageFinal, message, stream, topic)
+            }
         } else {
             if j.Locked == false {
                 // currentDate - oldDate in minutes
@@ -197,42 +294,37 @@ func AlarmCheckDown(service string, message string, noInterval bool) {
                         LogError("Error marshalling JSON: \n" + err.Error())
                     }
 
-                    err = os.WriteFile(filePath, jsonData, 0644)
+                    err = AtomicWriteFile(filePath, jsonData, 0644)
 
                     if err != nil {
                         LogError("Error writing to file: \n" + err.Error())
                     }
 
-                    Alarm(messageFinal, "", "", false)
+                    if !quiet {
+                        alarmDown(messageFinal, message, stream, topic)
+                    }
                 }
             }
         }
     } else {
+        alert := (Config.Alarm.Interval == 0 || noInterval == true) && !quiet
 
-        file, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR, 0644)
-        defer file.Close() 
-
-        if err != nil {
-            LogError("Error opening file for writing: \n" + err.Error())
-            return
-        }
-        
-        jsonData, err := json.Marshal(&ServiceFile{Date: currentDate, Locked: false})
+        jsonData, err := json.Marshal(&ServiceFile{Date: currentDate, Locked: false, Alerted: alertedPtr(alert)})
         
         if err != nil {
             LogError("Error marshalling JSON: \n" + err.Error())
         }
 
 
-        err = os.WriteFile(filePath, jsonData, 0644)
+        err = AtomicWriteFile(filePath, jsonData, 0644)
 
         if err != nil {
             LogError("Error writing to file: \n" + err.Error())
         }
 
 
-        if Config.Alarm.Interval == 0 || noInterval == true {
-            Alarm(messageFinal, "", "", false)
+        if alert {
+            alarmDown(messageFinal, message, stream, topic)
         }
     }        
 }
@@ -243,11 +335,181 @@ type ResponseData struct {
     Code string `json:"code"`
 }
 
+type alarmMessage struct {
+    message string
+    customStream string
+    customTopic string
+    onlyFirstWebhook bool
+    // Retry the spooled alarms instead of sending a message
+    retrySpool bool
+}
+
+const alarmQueueSize = 100
+var alarmQueueTimeout = 10 * time.Second
+
+var alarmQueue chan alarmMessage
+var alarmQueueOnce sync.Once
+var alarmPending sync.WaitGroup
+
+func alarmWorker() {
+    for a := range alarmQueue {
+        if a.retrySpool {
+            flushAlarmSpool()
+        } else {
+            sendAlarm(a.message, a.customStream, a.customTopic, a.onlyFirstWebhook)
+        }
+        alarmPending.Done()
+    }
+}
+
+// Alarm queues the message to be sent by a single background worker, so
+// the alarms are delivered in the order they were queued. AlarmFlush has
+// to be called before exiting to make sure they are all delivered.
 func Alarm(m string, customStream string, customTopic string, onlyFirstWebhook bool) {
     if Config.Alarm.Enabled == false {
         return
     }
 
+    startAlarmWorker()
+
+    alarmPending.Add(1)
+
+    select {
+    case alarmQueue <- alarmMessage{message: m, customStream: customStream, customTopic: customTopic, onlyFirstWebhook: onlyFirstWebhook}:
+    case <-time.After(alarmQueueTimeout):
+        alarmPending.Done()
+        LogError("Alarm queue is full, dropping alarm: \n" + m)
+    }
+}
+
+// startAlarmWorker starts the worker, the spooled alarms are queued first
+// so they are delivered before the new ones. Returns whether it was
+// started by this call.
+func startAlarmWorker() bool {
+    started := false
+
+    alarmQueueOnce.Do(func() {
+        alarmQueue = make(chan alarmMessage, alarmQueueSize)
+        alarmPending.Add(1)
+        alarmQueue <- alarmMessage{retrySpool: true}
+        go alarmWorker()
+        started = true
+    })
+
+    return started
+}
+
+// AlarmRetrySpool queues a retry of the spooled alarms ahead of the alarms
+// queued after it. The worker only retries them by itself when it starts,
+// the daemon calls this at the start of every cycle.
+func AlarmRetrySpool() {
+    if !Config.Alarm.Enabled || !FileExists(alarmSpoolPath()) {
+        return
+    }
+
+    if startAlarmWorker() {
+        return
+    }
+
+    alarmPending.Add(1)
+    alarmQueue <- alarmMessage{retrySpool: true}
+}
+
+// AlarmFlush blocks until every queued alarm has been sent. The spooled
+// alarms are retried even if no alarm was queued in this run.
+func AlarmFlush() {
+    AlarmGroupFlush()
+
+    if Config.Alarm.Enabled && FileExists(alarmSpoolPath()) {
+        startAlarmWorker()
+    }
+
+    alarmPending.Wait()
+}
+
+// truncateAlarm cuts m to at most maxLength bytes at a line boundary,
+// closing an unterminated code block, returns the number of lines removed.
+func truncateAlarm(m string, maxLength int) (string, int) {
+    if len(m) <= maxLength {
+        return m, 0
+    }
+
+    lines := strings.Split(m, "\n")
+    // Leave room for the closing fence and the truncation marker
+    budget := maxLength - 64
+    length := 0
+    kept := 0
+
+    for kept < len(lines) && length + len(lines[kept]) + 1 <= budget {
+        length += len(lines[kept]) + 1
+        kept++
+    }
+
+    truncated := strings.Join(lines[:kept], "\n")
+
+    if kept == 0 && budget > 0 {
+        // A single line longer than the limit
+        truncated = strings.ToValidUTF8(lines[0][:budget], "")
+        kept = 1
+    }
+
+    if strings.Count(truncated, "```") % 2 == 1 {
+        truncated += "\n```"
+    }
+
+    return truncated, len(lines) - kept
+}
+
+// pasteAlarm uploads m to alarm.paste_url and returns the link the paste
+// service responds with
+func pasteAlarm(m string) (string, error) {
+    client := HTTPClient(10 * time.Second, nil)
+
+    res, err := client.Post(Config.Alarm.Paste_Url, "text/plain; charset=utf-8", strings.NewReader(m))
+    if err != nil {
+        return "", err
+    }
+    defer res.Body.Close()
+
+    link, err := io.ReadAll(res.Body)
+    if err != nil {
+        return "", err
+    }
+
+    if res.StatusCode < 200 || res.StatusCode > 299 {
+        return "", errors.New("paste service returned " + res.Status)
+    }
+
+    return strings.TrimSpace(string(link)), nil
+}
+
+func sendAlarm(m string, customStream string, customTopic string, onlyFirstWebhook bool) {
+    maxLength := Config.Alarm.Max_Length
+    if maxLength == 0 {
+        maxLength = 9000
+    }
+
+    if truncated, removed := truncateAlarm(m, maxLength); removed > 0 {
+        truncated += "\n...(truncated, " + strconv.Itoa(removed) + " more lines)"
+
+        if Config.Alarm.Paste_Url != "" {
+            link, err := pasteAlarm(m)
+            if err != nil {
+                LogError("Error uploading the full alarm: \n" + err.Error())
+            } else {
+                truncated += "\nFull message: " + link
+            }
+        }
+
+        m = truncated
+    }
+
+    if Config.Alarm.Teams_Webhook_Url != "" {
+        if err := sendTeamsAlarm(m); err != nil {
+            LogError("Error sending the alarm to Teams: \n" + err.Error())
+        }
+    }
+
     message := strings.Replace(m, "\n", `\n`, -1)
 
     body:= []byte(`{"text":"` + message + `"}`)
@@ -267,10 +529,19 @@ func Alarm(m string, customStream string, customTopic string, onlyFirstWebhook b
             LogError("Error creating request for the alarm: \n" + err.Error())
         }
 
-        res, err := http.DefaultClient.Do(r)
+        res, err := HTTPClient(0, nil).Do(r)
         
         if err != nil {
             LogError("Error sending request for the alarm: \n" + err.Error())
+            spoolAlarm(webhook_url, body)
+            continue
+        }
+
+        if res.StatusCode >= 500 {
+            LogError("Error sending alarm: webhook returned " + res.Status)
+            spoolAlarm(webhook_url, body)
+            res.Body.Close()
+            continue
         }
 
         responseBody, err := io.ReadAll(res.Body)
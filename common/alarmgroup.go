@@ -0,0 +1,60 @@
+package common
+
+import (
+    "sync"
+    "strconv"
+    "strings"
+)
+
+type alarmGroup struct {
+    header string
+    stream string
+    topic string
+    messages []string
+    first string
+}
+
+var alarmGroups []*alarmGroup
+var alarmGroupsLock sync.Mutex
+
+// alarmDown sends the down alarm right away, or adds it to the group of
+// its route to be sent by AlarmGroupFlush when alarm.group_per_run is set.
+// The state of each service is still tracked on its own.
+func alarmDown(messageFinal string, message string, stream string, topic string) {
+    if !Config.Alarm.Group_Per_Run {
+        Alarm(messageFinal, stream, topic, false)
+        return
+    }
+
+    alarmGroupsLock.Lock()
+    defer alarmGroupsLock.Unlock()
+
+    header := "[" + ScriptName + " - " + Config.Identifier + "] [:red_circle:]"
+
+    for _, group := range alarmGroups {
+        if group.header == header && group.stream == stream && group.topic == topic {
+            group.messages = append(group.messages, message)
+            return
+        }
+    }
+
+    alarmGroups = append(alarmGroups, &alarmGroup{header: header, stream: stream, topic: topic, messages: []string{message}, first: messageFinal})
+}
+
+// AlarmGroupFlush sends the grouped down alarms, one message per component
+// and route
+func AlarmGroupFlush() {
+    alarmGroupsLock.Lock()
+    groups := alarmGroups
+    alarmGroups = nil
+    alarmGroupsLock.Unlock()
+
+    for _, group := range groups {
+        if len(group.messages) == 1 {
+            Alarm(group.first, group.stream, group.topic, false)
+            continue
+        }
+
+        Alarm(group.header + " " + strconv.Itoa(len(group.messages)) + " problems:\n- " + strings.Join(group.messages, "\n- "), group.stream, group.topic, false)
+    }
+}
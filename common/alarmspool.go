@@ -0,0 +1,151 @@
+package common
+
+import (
+    "io"
+    "os"
+    "sync"
+    "time"
+    "bytes"
+    "strconv"
+    "net/http"
+    "encoding/json"
+)
+
+// alarmSpoolVersion is the schema version of the alarm spool
+const alarmSpoolVersion = 1
+
+// alarmSpoolMax is the maximum number of alarms kept in the spool, the
+// oldest ones are dropped first
+const alarmSpoolMax = 500
+
+type spooledAlarm struct {
+    Url string `json:"url"`
+    Body string `json:"body"`
+    Queued time.Time `json:"queued"`
+}
+
+var alarmSpoolLock sync.Mutex
+
+// alarmSpoolPath is shared by all components, the webhooks are global
+func alarmSpoolPath() string {
+    return TmpBaseDir + "alarm-spool.json"
+}
+
+// lockAlarmSpool serializes the changes to the spool within the process
+// and with the other monokit processes, eg. a cron run next to the daemon
+func lockAlarmSpool() func() {
+    alarmSpoolLock.Lock()
+
+    unlock, err := LockFile(alarmSpoolPath() + ".lock")
+    if err != nil {
+        LogError("Error locking the alarm spool: " + err.Error())
+        return alarmSpoolLock.Unlock
+    }
+
+    return func() {
+        unlock()
+        alarmSpoolLock.Unlock()
+    }
+}
+
+func loadAlarmSpool() []spooledAlarm {
+    var spool []spooledAlarm
+    if !LoadCache(alarmSpoolPath(), alarmSpoolVersion, &spool) {
+        return nil
+    }
+    return spool
+}
+
+func saveAlarmSpool(spool []spooledAlarm) {
+    if len(spool) == 0 {
+        if FileExists(alarmSpoolPath()) {
+            if err := os.Remove(alarmSpoolPath()); err != nil {
+                LogError("Error removing the alarm spool: " + err.Error())
+            }
+        }
+        return
+    }
+
+    if len(spool) > alarmSpoolMax {
+        spool = spool[len(spool) - alarmSpoolMax:]
+    }
+
+    if err := SaveCache(alarmSpoolPath(), alarmSpoolVersion, spool); err != nil {
+        LogError("Error writing the alarm spool: " + err.Error())
+    }
+}
+
+// spoolAlarm keeps an alarm the webhook couldn't be reached for, to retry
+// it on the next run
+func spoolAlarm(url string, body []byte) {
+    defer lockAlarmSpool()()
+
+    saveAlarmSpool(append(loadAlarmSpool(), spooledAlarm{Url: url, Body: string(body), Queued: time.Now()}))
+}
+
+// postSpooledAlarm resends a spooled alarm, returns false if it has to stay
+// in the spool
+func postSpooledAlarm(alarm spooledAlarm) bool {
+    r, err := http.NewRequest("POST", alarm.Url, bytes.NewBufferString(alarm.Body))
+    if err != nil {
+        LogError("Error creating request for a spooled alarm, dropping it: \n" + err.Error())
+        return true
+    }
+    r.Header.Set("Content-Type", "application/json")
+
+    res, err := HTTPClient(10 * time.Second, nil).Do(r)
+    if err != nil {
+        return false
+    }
+    defer res.Body.Close()
+    io.Copy(io.Discard, res.Body)
+
+    return res.StatusCode < 500
+}
+
+// flushAlarmSpool retries the spooled alarms in order. The ones older than
+// alarm.spool_max_age_hours are dropped, reported with a summary. Once a
+// webhook fails again its remaining alarms are kept for the next run.
+func flushAlarmSpool() {
+    defer lockAlarmSpool()()
+
+    spool := loadAlarmSpool()
+    if len(spool) == 0 {
+        return
+    }
+
+    maxAge := Config.Alarm.Spool_Max_Age_Hours
+    if maxAge == 0 {
+        maxAge = 24
+    }
+
+    var kept []spooledAlarm
+    dropped := make(map[string]int)
+    failed := make(map[string]bool)
+
+    for _, alarm := range spool {
+        if time.Since(alarm.Queued).Hours() > maxAge {
+            dropped[alarm.Url]++
+            continue
+        }
+
+        if failed[alarm.Url] || !postSpooledAlarm(alarm) {
+            failed[alarm.Url] = true
+            kept = append(kept, alarm)
+        }
+    }
+
+    saveAlarmSpool(kept)
+
+    for url, count := range dropped {
+        message := "[" + ScriptName + " - " + Config.Identifier + "] [:warning:] " + strconv.Itoa(count) + " alarms couldn't be delivered for more than " + strconv.FormatFloat(maxAge, 'f', -1, 64) + " hours and were dropped"
+        LogError(message)
+
+        if failed[url] {
+            continue
+        }
+
+        body, _ := json.Marshal(map[string]string{"text": message})
+        postSpooledAlarm(spooledAlarm{Url: url, Body: string(body)})
+    }
+}
@@ -0,0 +1,144 @@
+package common
+
+import (
+    "os"
+    "fmt"
+    "sync"
+    "time"
+    "bytes"
+    "strings"
+    "encoding/json"
+    "github.com/spf13/cobra"
+)
+
+// AuditLogPath is set by LogInit next to the general log
+var AuditLogPath = "/var/log/monokit-audit.log"
+
+type AuditEntry struct {
+    Time string `json:"time"`
+    Component string `json:"component"`
+    Action string `json:"action"`
+    Target string `json:"target"`
+    Outcome string `json:"outcome"`
+}
+
+var AuditCmd = &cobra.Command{
+    Use: "audit",
+    Short: "Show the changes monokit made on this host",
+    Run: func(cmd *cobra.Command, args []string) {
+        Init()
+        limit, _ := cmd.Flags().GetInt("limit")
+        component, _ := cmd.Flags().GetString("component")
+
+        entries, err := AuditEntries()
+        if err != nil {
+            LogError("Error reading the audit log: " + err.Error())
+            os.Exit(1)
+        }
+
+        var filtered []AuditEntry
+        for _, entry := range entries {
+            if component == "" || entry.Component == component {
+                filtered = append(filtered, entry)
+            }
+        }
+
+        if limit > 0 && len(filtered) > limit {
+            filtered = filtered[len(filtered)-limit:]
+        }
+
+        for _, entry := range filtered {
+            fmt.Println(entry.Time + " [" + entry.Component + "] " + entry.Action + " " + entry.Target + ": " + entry.Outcome)
+        }
+    },
+}
+
+var auditMu sync.Mutex
+
+// auditMaxSize is the size the audit log is rotated at, the previous log
+// is kept with a .1 suffix
+const auditMaxSize = 10 * 1024 * 1024
+
+// Audit records a change made on the host, eg. a restarted service or an
+// edited file, in the audit log. err is the outcome of the action.
+func Audit(action string, target string, err error) {
+    outcome := "ok"
+    if err != nil {
+        outcome = "error: " + err.Error()
+    }
+
+    entry, jsonErr := json.Marshal(AuditEntry{
+        Time: time.Now().Format(time.RFC3339),
+        Component: ScriptName,
+        Action: action,
+        Target: target,
+        Outcome: outcome,
+    })
+
+    if jsonErr != nil {
+        LogError("Error marshalling the audit entry: " + jsonErr.Error())
+        return
+    }
+
+    auditMu.Lock()
+    defer auditMu.Unlock()
+
+    // The daemon and the cron jobs write to the same log
+    unlock, lockErr := LockFile(AuditLogPath + ".lock")
+    if lockErr != nil {
+        LogError("Error locking the audit log: " + lockErr.Error())
+    } else {
+        defer unlock()
+    }
+
+    if info, statErr := os.Stat(AuditLogPath); statErr == nil && info.Size() > auditMaxSize {
+        if renameErr := os.Rename(AuditLogPath, AuditLogPath + ".1"); renameErr != nil {
+            LogError("Error rotating the audit log: " + renameErr.Error())
+        }
+    }
+
+    file, openErr := os.OpenFile(AuditLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+    if openErr != nil {
+        LogError("Error opening the audit log: " + openErr.Error())
+        return
+    }
+    defer file.Close()
+
+    // A single write of the whole line, so it is appended in one piece
+    if _, writeErr := file.Write(append(entry, '\n')); writeErr != nil {
+        LogError("Error writing the audit log: " + writeErr.Error())
+    }
+}
+
+// AuditEntries returns the entries of the rotated and the current audit
+// log, the oldest first
+func AuditEntries() ([]AuditEntry, error) {
+    var entries []AuditEntry
+    var file []byte
+
+    for _, path := range []string{AuditLogPath + ".1", AuditLogPath} {
+        content, err := os.ReadFile(path)
+        if err != nil {
+            if os.IsNotExist(err) {
+                continue
+            }
+            return nil, err
+        }
+        file = append(file, content...)
+    }
+
+    for _, line := range bytes.Split(file, []byte("\n")) {
+        if strings.TrimSpace(string(line)) == "" {
+            continue
+        }
+
+        var entry AuditEntry
+        if err := json.Unmarshal(line, &entry); err != nil {
+            continue
+        }
+
+        entries = append(entries, entry)
+    }
+
+    return entries, nil
+}
@@ -0,0 +1,82 @@
+package common
+
+import (
+    "os"
+    "strconv"
+    "encoding/json"
+)
+
+// cacheErrors are the caches that couldn't be saved or loaded in this run,
+// reset by Init
+var cacheErrors []string
+
+// CacheErrors returns the caches that couldn't be saved or loaded in this
+// run. A cache that doesn't exist yet or has an older schema version is not
+// an error.
+func CacheErrors() []string {
+    return cacheErrors
+}
+
+type cacheFile struct {
+    SchemaVersion int `json:"schema_version"`
+    Data json.RawMessage `json:"data"`
+}
+
+// SaveCache writes data to path as JSON, tagged with the schema version of
+// its type. The version has to be increased whenever the type changes in
+// a way older caches can't be decoded into.
+func SaveCache(path string, schemaVersion int, data interface{}) error {
+    err := saveCache(path, schemaVersion, data)
+    if err != nil {
+        cacheErrors = append(cacheErrors, "saving " + path + ": " + err.Error())
+    }
+
+    return err
+}
+
+func saveCache(path string, schemaVersion int, data interface{}) error {
+    jsonData, err := json.Marshal(data)
+    if err != nil {
+        return err
+    }
+
+    file, err := json.Marshal(cacheFile{SchemaVersion: schemaVersion, Data: jsonData})
+    if err != nil {
+        return err
+    }
+
+    return AtomicWriteFile(path, file, 0644)
+}
+
+// LoadCache decodes the cache at path into data and reports whether it was
+// loaded. Caches written with another schema version are discarded so the
+// caller starts fresh instead of decoding into an incompatible shape.
+func LoadCache(path string, schemaVersion int, data interface{}) bool {
+    file, err := os.ReadFile(path)
+    if err != nil {
+        if !os.IsNotExist(err) {
+            cacheErrors = append(cacheErrors, "loading " + path + ": " + err.Error())
+        }
+        return false
+    }
+
+    var cache cacheFile
+    if err := json.Unmarshal(file, &cache); err != nil {
+        LogError("Error parsing cache " + path + ", discarding it: " + err.Error())
+        cacheErrors = append(cacheErrors, "loading " + path + ": " + err.Error())
+        return false
+    }
+
+    if cache.SchemaVersion != schemaVersion {
+        LogError("Cache " + path + " has schema version " + strconv.Itoa(cache.SchemaVersion) + " instead of " + strconv.Itoa(schemaVersion) + ", discarding it")
+        return false
+    }
+
+    if err := json.Unmarshal(cache.Data, data); err != nil {
+        LogError("Error decoding cache " + path + ", discarding it: " + err.Error())
+        cacheErrors = append(cacheErrors, "loading " + path + ": " + err.Error())
+        return false
+    }
+
+    return true
+}
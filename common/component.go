@@ -0,0 +1,170 @@
+package common
+
+import (
+    "os"
+    "errors"
+    "reflect"
+    "strings"
+)
+
+// KnownComponents are the state directories the components create under
+// TmpBaseDir
+var KnownComponents = []string{
+    "osHealth", "pritunlHealth", "postalHealth", "pmgHealth", "zimbraHealth",
+    "k8sHealth", "mysqlHealth", "pgsqlHealth", "redisHealth", "rmqHealth",
+    "traefikHealth", "wppconnectHealth", "assertServices", "commandCheck", "glb",
+}
+
+// InstalledComponents returns the known components that have a state
+// directory, ie. the ones that have run on this host. Unknown directories
+// are ignored.
+func InstalledComponents() []string {
+    var installed []string
+
+    entries, err := os.ReadDir(TmpBaseDir)
+    if err != nil {
+        if !os.IsNotExist(err) {
+            LogError("Error reading " + TmpBaseDir + ": " + err.Error())
+        }
+        return installed
+    }
+
+    for _, entry := range entries {
+        if entry.IsDir() && IsInArray(entry.Name(), KnownComponents) {
+            installed = append(installed, entry.Name())
+        }
+    }
+
+    return installed
+}
+
+// CollectOnlyMode makes the components only observe, without restarting
+// services, editing files or creating Redmine issues.
+var CollectOnlyMode bool
+
+// Component is a health check run by the daemon. DependsOn lists the
+// components that have to run before it, eg. because it reads their
+// files in TmpDir, it is skipped when one of them didn't run. The
+// components check CollectOnlyMode themselves before
+// any side effect. Config is the name of the config file the component
+// reads into ConfigType, LinuxOnly components do nothing on other
+// platforms.
+type Component struct {
+    Name string
+    DependsOn []string
+    Enabled func() bool
+    Run func()
+    Config string
+    ConfigType interface{}
+    LinuxOnly bool
+}
+
+// ConfigKeys returns the config keys config can be loaded from, nested keys
+// are separated by dots
+func ConfigKeys(config interface{}) []string {
+    if config == nil {
+        return nil
+    }
+
+    return configKeys(reflect.TypeOf(config), "")
+}
+
+func configKeys(t reflect.Type, prefix string) []string {
+    for t.Kind() == reflect.Pointer {
+        t = t.Elem()
+    }
+
+    if t.Kind() != reflect.Struct {
+        return nil
+    }
+
+    var keys []string
+
+    for i := 0; i < t.NumField(); i++ {
+        field := t.Field(i)
+        if !field.IsExported() {
+            continue
+        }
+
+        key := prefix + strings.ToLower(field.Name)
+
+        fieldType := field.Type
+        for fieldType.Kind() == reflect.Pointer {
+            fieldType = fieldType.Elem()
+        }
+
+        if fieldType.Kind() == reflect.Struct && fieldType.PkgPath() != "time" {
+            keys = append(keys, configKeys(fieldType, key + ".")...)
+        } else {
+            keys = append(keys, key)
+        }
+    }
+
+    return keys
+}
+
+// MissingDependencies returns the dependencies of the component that are
+// not in ran, ie. the ones that aren't enabled on this host
+func (c Component) MissingDependencies(ran map[string]bool) []string {
+    var missing []string
+    for _, dep := range c.DependsOn {
+        if !ran[dep] {
+            missing = append(missing, dep)
+        }
+    }
+    return missing
+}
+
+// OrderComponents returns the components sorted so that every component
+// comes after its dependencies, keeping the given order otherwise. An error
+// is returned for unknown dependencies and dependency cycles.
+func OrderComponents(components []Component) ([]Component, error) {
+    byName := make(map[string]Component)
+    for _, component := range components {
+        byName[component.Name] = component
+    }
+
+    var ordered []Component
+    done := make(map[string]bool)
+    var visiting []string
+
+    var visit func(component Component) error
+    visit = func(component Component) error {
+        if done[component.Name] {
+            return nil
+        }
+
+        for i, name := range visiting {
+            if name == component.Name {
+                return errors.New("dependency cycle: " + strings.Join(append(visiting[i:], name), " -> "))
+            }
+        }
+
+        visiting = append(visiting, component.Name)
+
+        for _, dep := range component.DependsOn {
+            depComponent, ok := byName[dep]
+            if !ok {
+                return errors.New("component " + component.Name + " depends on unknown component " + dep)
+            }
+
+            if err := visit(depComponent); err != nil {
+                return err
+            }
+        }
+
+        visiting = visiting[:len(visiting)-1]
+        done[component.Name] = true
+        ordered = append(ordered, component)
+
+        return nil
+    }
+
+    for _, component := range components {
+        if err := visit(component); err != nil {
+            return nil, err
+        }
+    }
+
+    return ordered, nil
+}
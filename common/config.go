@@ -2,18 +2,74 @@ package common
 
 import (
     "os"
+    "errors"
+    "sort"
+    "strings"
     "github.com/spf13/viper"
+    "github.com/sirupsen/logrus"
+    "github.com/mitchellh/mapstructure"
 )
 
+type Route struct {
+    Stream string
+    Topic string
+}
+
 type Common struct {
     Identifier string
+    User_Agent string
+    Max_Command_Output_Kb int
 
     Alarm struct {
         Enabled bool
         Interval float64
         Webhook_urls []string
+        Teams_Webhook_Url string
+        Spool_Max_Age_Hours float64
+        Group_Per_Run bool
+        Correlation_Ids bool
+
+        Flap struct {
+            Enabled bool
+            Threshold int
+            Window float64
+            Stable float64
+        }
+
+        Routes map[string]Route
+        Escalation []EscalationLevel
+
+        Max_Length int
+        Paste_Url string
+        Quiet_First_Run bool
+        Stale_Minutes float64
+        Stale_Runs float64
     }
     
+    Inventory struct {
+        Url string
+        Api_Key string
+        Interval_Hours float64
+    }
+
+    State_Storage struct {
+        Max_Size_Mb float64
+        Min_Free_Mb float64
+        Prune_Days float64
+    }
+
+    Output struct {
+        Destination string
+        Time_Format string
+        Locale string
+    }
+
+    Dns struct {
+        Servers []string
+        Timeout_Ms int
+        Concurrency int
+    }
+
     Redmine struct {
         Enabled bool
         Project_id string
@@ -21,19 +77,49 @@ type Common struct {
         Status_id int
         Priority_id int
         Interval float64
+        Note_Interval float64
+        Close_Concurrency int
+        Request_Delay_Ms int
+        Dry_Run bool
+        Unreachable_Retry_Minutes float64
 
         Api_key string
         Url string
+        Tls TlsClient
     }
 }
 
+// ConfigDir is set through the --config-dir flag
+var ConfigDir string
+
+// ConfigDirs returns the directories config files are searched in, in order
+// of precedence: --config-dir, MONOKIT_CONFIG_DIR (colon separated) and
+// /etc/mono.
+func ConfigDirs() []string {
+    var dirs []string
+
+    if ConfigDir != "" {
+        dirs = append(dirs, ConfigDir)
+    }
+
+    for _, dir := range strings.Split(os.Getenv("MONOKIT_CONFIG_DIR"), ":") {
+        if dir != "" {
+            dirs = append(dirs, dir)
+        }
+    }
+
+    return append(dirs, "/etc/mono")
+}
+
 func ConfExists(configName string) bool {
     yamlFiles := [2]string{configName + ".yaml", configName + ".yml"}
 
-    for _, file := range yamlFiles {
-        // Check if the file exists
-        if _, err := os.Stat("/etc/mono/" + file); err == nil {
-            return true
+    for _, dir := range ConfigDirs() {
+        for _, file := range yamlFiles {
+            // Check if the file exists
+            if _, err := os.Stat(dir + "/" + file); err == nil {
+                return true
+            }
         }
     }
 
@@ -41,26 +127,170 @@ func ConfExists(configName string) bool {
 }
 
 
-func ConfInit(configName string, config interface{}) interface{} {
+// ConfInitE loads the config named configName into config. Unlike ConfInit,
+// it returns the read/unmarshal errors instead of panicking, along with the
+// keys of the config file that do not map to any field of config.
+func ConfInitE(configName string, config interface{}) ([]string, error) {
     viper.SetConfigName(configName)
-    viper.AddConfigPath("/etc/mono")
+    for _, dir := range ConfigDirs() {
+        viper.AddConfigPath(dir)
+    }
     viper.SetConfigType("yaml")
 
     viper.SetDefault("alarm.interval", 3)
+    viper.SetDefault("alarm.quiet_first_run", true)
+    viper.SetDefault("alarm.flap.threshold", 4)
+    viper.SetDefault("alarm.flap.window", 30)
+    viper.SetDefault("alarm.flap.stable", 30)
 
     err := viper.ReadInConfig()
-    
+
     if err != nil {
-        LogError("Fatal error while trying to parse the config file: \n" + err.Error())
-        panic(err)
+        return nil, err
+    }
+
+    var metadata mapstructure.Metadata
+
+    err = viper.Unmarshal(&config, func(dc *mapstructure.DecoderConfig) {
+        dc.Metadata = &metadata
+    })
+
+    if err != nil {
+        return nil, err
     }
 
-    err = viper.Unmarshal(&config)
+    // Defaults are never unknown, only report what is set in the file
+    var unknownKeys []string
+
+    for _, key := range metadata.Unused {
+        key = strings.ToLower(key)
+        if viper.InConfig(key) {
+            unknownKeys = append(unknownKeys, key)
+        }
+    }
 
+    unknownOverrides, err := applyEnvOverrides(configName, config)
     if err != nil {
-        LogError("Fatal error while trying to unmarshal the config file: \n" + err.Error())
+        return nil, err
+    }
+
+    unknownKeys = append(unknownKeys, unknownOverrides...)
+
+    sort.Strings(unknownKeys)
+
+    return unknownKeys, nil
+}
+
+// envOverridePrefix returns the prefix of the environment variables that
+// override the keys of the config, eg. MONOKIT_OVERRIDE_SSH_NOTIFIER_ for
+// ssh-notifier
+func envOverridePrefix(configName string) string {
+    return "MONOKIT_OVERRIDE_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(configName)) + "_"
+}
+
+// envOverrides returns the overrides of the config from the environment as
+// a nested map. Nested keys are separated by a double underscore, eg.
+// MONOKIT_OVERRIDE_MAIL_PMG__QUEUE_LIMIT=10 sets pmg.queue_limit.
+func envOverrides(configName string) map[string]interface{} {
+    prefix := envOverridePrefix(configName)
+    overrides := make(map[string]interface{})
+
+    for _, env := range os.Environ() {
+        name, value, found := strings.Cut(env, "=")
+        if !found || !strings.HasPrefix(name, prefix) || len(name) == len(prefix) {
+            continue
+        }
+
+        path := strings.Split(strings.ToLower(strings.TrimPrefix(name, prefix)), "__")
+        current := overrides
+
+        for _, key := range path[:len(path) - 1] {
+            next, ok := current[key].(map[string]interface{})
+            if !ok {
+                next = make(map[string]interface{})
+                current[key] = next
+            }
+            current = next
+        }
+
+        current[path[len(path) - 1]] = value
+    }
+
+    return overrides
+}
+
+// applyEnvOverrides decodes the environment overrides over config, returns
+// the overridden keys that don't map to any field
+func applyEnvOverrides(configName string, config interface{}) ([]string, error) {
+    overrides := envOverrides(configName)
+    if len(overrides) == 0 {
+        return nil, nil
+    }
+
+    var metadata mapstructure.Metadata
+
+    decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+        Result: config,
+        Metadata: &metadata,
+        WeaklyTypedInput: true,
+        // Replace lists instead of overwriting their first elements
+        ZeroFields: true,
+        DecodeHook: mapstructure.ComposeDecodeHookFunc(
+            mapstructure.StringToTimeDurationHookFunc(),
+            mapstructure.StringToSliceHookFunc(","),
+        ),
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    if err := decoder.Decode(overrides); err != nil {
+        return nil, errors.New("invalid " + envOverridePrefix(configName) + "* override: " + err.Error())
+    }
+
+    var unknownKeys []string
+    for _, key := range metadata.Unused {
+        unknownKeys = append(unknownKeys, strings.ToLower(key) + " (" + envOverridePrefix(configName) + "*)")
+    }
+
+    return unknownKeys, nil
+}
+
+func ConfInit(configName string, config interface{}) interface{} {
+    unknownKeys, err := ConfInitE(configName, config)
+
+    if err != nil {
+        LogError("Fatal error while trying to load the config file: \n" + err.Error())
         panic(err)
     }
 
+    for _, key := range unknownKeys {
+        logrus.Warn("Unknown key '" + key + "' in the " + configName + " config")
+    }
+
     return config
 }
+
+// ValidateIdentifier warns when Identifier doesn't have the expected
+// <project>-<host> shape the Redmine project is derived from.
+func ValidateIdentifier() {
+    if Config.Identifier == "" {
+        logrus.Warn("identifier is not set in global.yml")
+        return
+    }
+
+    parts := strings.SplitN(Config.Identifier, "-", 2)
+    if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+        logrus.Warn("identifier '" + Config.Identifier + "' doesn't match the <project>-<host> format, the Redmine project will be '" + ProjectID() + "'")
+    }
+}
+
+// ProjectID returns the Redmine project, redmine.project_id if set or the
+// part of the identifier before the first hyphen.
+func ProjectID() string {
+    if Config.Redmine.Project_id != "" {
+        return Config.Redmine.Project_id
+    }
+
+    return strings.Split(Config.Identifier, "-")[0]
+}
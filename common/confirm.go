@@ -0,0 +1,59 @@
+package common
+
+import (
+    "os"
+    "time"
+    "strings"
+    "encoding/json"
+)
+
+type pendingDown struct {
+    Since time.Time
+    Checks int
+}
+
+func pendingDownPath(name string) string {
+    return TmpDir + "/" + strings.Replace(name, "/", "-", -1) + "-pending.log"
+}
+
+// ConfirmDown reports whether a down service should be alarmed, ie. it has
+// been down for at least checks consecutive checks or minutes, whichever is
+// set and reached first. Without either it is confirmed right away. An up
+// service resets the count, so a recovery within the grace goes unnoticed.
+func ConfirmDown(name string, down bool, checks int, minutes float64) bool {
+    filePath := pendingDownPath(name)
+
+    if !down {
+        if FileExists(filePath) {
+            if err := os.Remove(filePath); err != nil {
+                LogError("Error removing the pending down state: \n" + err.Error())
+            }
+        }
+        return false
+    }
+
+    if checks <= 1 && minutes <= 0 {
+        return true
+    }
+
+    var pending pendingDown
+    if file, err := os.ReadFile(filePath); err != nil || json.Unmarshal(file, &pending) != nil {
+        pending = pendingDown{Since: time.Now()}
+    }
+
+    pending.Checks++
+
+    jsonData, err := json.Marshal(pending)
+    if err == nil {
+        err = AtomicWriteFile(filePath, jsonData, 0644)
+    }
+    if err != nil {
+        LogError("Error writing the pending down state: \n" + err.Error())
+    }
+
+    if checks > 1 && pending.Checks >= checks {
+        return true
+    }
+
+    return minutes > 0 && time.Since(pending.Since).Minutes() >= minutes
+}
@@ -0,0 +1,75 @@
+package common
+
+import (
+    "os"
+    "sync"
+    "time"
+    "strings"
+    "path/filepath"
+)
+
+// deltaCacheVersion is the schema version of the delta state
+const deltaCacheVersion = 1
+
+type deltaSample struct {
+    Value float64 `json:"value"`
+    Time string `json:"time"`
+}
+
+var deltaLock sync.Mutex
+
+func deltaPath(module string) string {
+    return TmpBaseDir + strings.Replace(module, "/", "-", -1) + "/deltas.json"
+}
+
+// Delta records current as the latest value of key in the state of module
+// and returns its change and the time elapsed since the previous run. On the
+// first run, or if the previous value couldn't be read, firstRun is true and
+// the delta is 0.
+func Delta(module string, key string, current float64) (delta float64, elapsed time.Duration, firstRun bool) {
+    return DeltaAfter(module, key, current, 0)
+}
+
+// DeltaAfter is Delta, except that the previous value is only replaced
+// once interval has elapsed since it was recorded. The runs more frequent
+// than interval are measured against the same baseline rather than the run
+// right before them.
+func DeltaAfter(module string, key string, current float64, interval time.Duration) (delta float64, elapsed time.Duration, firstRun bool) {
+    deltaLock.Lock()
+    defer deltaLock.Unlock()
+
+    now := time.Now()
+    path := deltaPath(module)
+
+    samples := make(map[string]deltaSample)
+    if !LoadCache(path, deltaCacheVersion, &samples) || samples == nil {
+        samples = make(map[string]deltaSample)
+    }
+
+    previous, found := samples[key]
+
+    var previousTime time.Time
+    var err error
+    if found {
+        previousTime, err = time.Parse(time.RFC3339Nano, previous.Time)
+        found = err == nil
+    }
+
+    if !found || now.Sub(previousTime) >= interval {
+        samples[key] = deltaSample{Value: current, Time: now.Format(time.RFC3339Nano)}
+
+        err = os.MkdirAll(filepath.Dir(path), 0755)
+        if err == nil {
+            err = SaveCache(path, deltaCacheVersion, samples)
+        }
+        if err != nil {
+            LogError("Error writing the delta state: " + err.Error())
+        }
+    }
+
+    if !found {
+        return 0, 0, true
+    }
+
+    return current - previous.Value, now.Sub(previousTime), false
+}
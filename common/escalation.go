@@ -0,0 +1,166 @@
+package common
+
+import (
+    "os"
+    "sort"
+    "time"
+    "strconv"
+    "strings"
+    "encoding/json"
+)
+
+// EscalationLevel is reached once a service has been down for After_Minutes,
+// the service is alarmed again, to Stream/Topic if they are set, and its
+// Redmine issue gets Redmine_Priority_Id if it is set
+type EscalationLevel struct {
+    After_Minutes float64
+    Stream string
+    Topic string
+    Redmine_Priority_Id int
+}
+
+type escalationState struct {
+    Since string `json:"since"`
+    Level int `json:"level"`
+}
+
+func escalationPath(service string) string {
+    return TmpDir + "/" + strings.Replace(service, "/", "-", -1) + "-escalation.log"
+}
+
+// escalationLevels returns the configured levels, the shortest first
+func escalationLevels() []EscalationLevel {
+    levels := append([]EscalationLevel{}, Config.Alarm.Escalation...)
+
+    sort.SliceStable(levels, func(i, k int) bool {
+        return levels[i].After_Minutes < levels[k].After_Minutes
+    })
+
+    return levels
+}
+
+func readEscalation(service string) (escalationState, bool) {
+    var state escalationState
+
+    fileRead, err := os.ReadFile(escalationPath(service))
+    if err != nil {
+        return state, false
+    }
+
+    if err := json.Unmarshal(fileRead, &state); err != nil {
+        return state, false
+    }
+
+    return state, true
+}
+
+func writeEscalation(service string, state escalationState) {
+    jsonData, err := json.Marshal(state)
+    if err == nil {
+        err = AtomicWriteFile(escalationPath(service), jsonData, 0644)
+    }
+    if err != nil {
+        LogError("Error writing the escalation state: \n" + err.Error())
+    }
+}
+
+// escalationRoute returns the route of level, falling back to the route of
+// service
+func escalationRoute(service string, level EscalationLevel) (string, string) {
+    if level.Stream != "" && level.Topic != "" {
+        return level.Stream, level.Topic
+    }
+    return alarmRoute(service)
+}
+
+// alarmEscalate records since when service is down and alarms again each
+// time it reaches a new escalation level.
+func alarmEscalate(service string, message string, quiet bool) {
+    levels := escalationLevels()
+    if len(levels) == 0 {
+        return
+    }
+
+    state, ok := readEscalation(service)
+    if !ok {
+        writeEscalation(service, escalationState{Since: time.Now().Format(time.RFC3339)})
+        return
+    }
+
+    since, err := time.Parse(time.RFC3339, state.Since)
+    if err != nil {
+        LogError("Error parsing the escalation date: \n" + err.Error())
+        return
+    }
+
+    down := time.Since(since)
+
+    reached := 0
+    for i, level := range levels {
+        if down.Minutes() >= level.After_Minutes {
+            reached = i + 1
+        }
+    }
+
+    if reached <= state.Level {
+        return
+    }
+
+    state.Level = reached
+    writeEscalation(service, state)
+
+    if quiet {
+        return
+    }
+
+    stream, topic := escalationRoute(service, levels[reached - 1])
+    Alarm("[" + ScriptName + " - " + Config.Identifier + "] [:rotating_light:] Escalated (level " + strconv.Itoa(reached) + "), down for " + HumanizeDuration(down) + ": " + message, stream, topic, false)
+}
+
+// alarmEscalationClear forgets the down time of service, the recovery is
+// also sent to the route of the reached escalation level.
+func alarmEscalationClear(service string, message string, quiet bool) {
+    state, ok := readEscalation(service)
+    if !ok {
+        return
+    }
+
+    os.Remove(escalationPath(service))
+
+    levels := escalationLevels()
+    if quiet || state.Level == 0 || state.Level > len(levels) {
+        return
+    }
+
+    level := levels[state.Level - 1]
+    if level.Stream == "" || level.Topic == "" {
+        return
+    }
+
+    down := "a while"
+    if since, err := time.Parse(time.RFC3339, state.Since); err == nil {
+        down = HumanizeDuration(time.Since(since))
+    }
+
+    Alarm("[" + ScriptName + " - " + Config.Identifier + "] [:check:] Recovered after " + down + ": " + message, level.Stream, level.Topic, false)
+}
+
+// EscalationPriority returns the Redmine priority of the highest escalation
+// level service has reached, or 0 if it has none
+func EscalationPriority(service string) int {
+    state, ok := readEscalation(service)
+    if !ok {
+        return 0
+    }
+
+    levels := escalationLevels()
+    priority := 0
+
+    for i := 0; i < state.Level && i < len(levels); i++ {
+        if levels[i].Redmine_Priority_Id != 0 {
+            priority = levels[i].Redmine_Priority_Id
+        }
+    }
+
+    return priority
+}
@@ -0,0 +1,24 @@
+package common
+
+// Exit codes of the health check commands, see the README
+const (
+    ExitHealthy = 0
+    // A service is down, ie. an alarm is active
+    ExitDegraded = 1
+    // A check couldn't be run, eg. the service couldn't be queried
+    ExitCheckFailed = 2
+)
+
+var exitCode = ExitHealthy
+
+// SetExitCode raises the exit code of the command to code, the most severe
+// code set during a run wins.
+func SetExitCode(code int) {
+    if code > exitCode {
+        exitCode = code
+    }
+}
+
+func ExitCode() int {
+    return exitCode
+}
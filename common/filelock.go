@@ -0,0 +1,28 @@
+//go:build !windows && !plan9
+
+package common
+
+import (
+    "os"
+    "syscall"
+)
+
+// LockFile takes an exclusive lock on path, creating it if needed, and
+// blocks until the other processes holding it are done. The returned
+// function releases the lock.
+func LockFile(path string) (func(), error) {
+    file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+    if err != nil {
+        return nil, err
+    }
+
+    if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+        file.Close()
+        return nil, err
+    }
+
+    return func() {
+        syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+        file.Close()
+    }, nil
+}
@@ -0,0 +1,90 @@
+package common
+
+import (
+    "os"
+    "time"
+    "strconv"
+    "strings"
+    "encoding/json"
+)
+
+type FlapFile struct {
+    Transitions []string `json:"transitions"`
+    LastTransition string `json:"last_transition"`
+    Flapping bool `json:"flapping"`
+}
+
+func flapFilePath(service string) string {
+    return TmpDir + "/" + strings.Replace(service, "/", "-", -1) + "-flap.log"
+}
+
+// flapCheck records whether the service changed state and reports whether
+// the regular up/down alarm should be suppressed because it is flapping.
+// A single alarm is sent when flapping starts and when it stabilizes.
+func flapCheck(service string, transition bool, state string) bool {
+    if Config.Alarm.Flap.Enabled == false {
+        return false
+    }
+
+    filePath := flapFilePath(service)
+    now := time.Now()
+    window := time.Duration(Config.Alarm.Flap.Window * float64(time.Minute))
+    stable := time.Duration(Config.Alarm.Flap.Stable * float64(time.Minute))
+
+    stream, topic := alarmRoute(service)
+
+    var f FlapFile
+
+    if fileRead, err := os.ReadFile(filePath); err == nil {
+        if err := json.Unmarshal(fileRead, &f); err != nil {
+            LogError("Error parsing JSON: \n" + err.Error())
+        }
+    }
+
+    if transition {
+        f.Transitions = append(f.Transitions, now.Format(time.RFC3339))
+        f.LastTransition = now.Format(time.RFC3339)
+    }
+
+    // Only keep the transitions inside the window
+    var recent []string
+    for _, t := range f.Transitions {
+        parsed, err := time.Parse(time.RFC3339, t)
+        if err == nil && now.Sub(parsed) <= window {
+            recent = append(recent, t)
+        }
+    }
+    f.Transitions = recent
+
+    suppress := f.Flapping
+
+    if f.Flapping {
+        lastTransition, err := time.Parse(time.RFC3339, f.LastTransition)
+        if err != nil || now.Sub(lastTransition) >= stable {
+            f.Flapping = false
+            f.Transitions = nil
+            Alarm("[" + ScriptName + " - " + Config.Identifier + "] [:check:] " + service + " has stabilized, it is now " + state, stream, topic, false)
+        }
+    } else if len(f.Transitions) >= Config.Alarm.Flap.Threshold {
+        f.Flapping = true
+        suppress = true
+        Alarm("[" + ScriptName + " - " + Config.Identifier + "] [:warning:] " + service + " is flapping, " + strconv.Itoa(len(f.Transitions)) + " state changes in the last " + strconv.FormatFloat(Config.Alarm.Flap.Window, 'f', 0, 64) + " minutes", stream, topic, false)
+    }
+
+    if len(f.Transitions) == 0 && !f.Flapping {
+        os.Remove(filePath)
+        return suppress
+    }
+
+    jsonData, err := json.Marshal(&f)
+    if err != nil {
+        LogError("Error marshalling JSON: \n" + err.Error())
+        return suppress
+    }
+
+    if err := AtomicWriteFile(filePath, jsonData, 0644); err != nil {
+        LogError("Error writing to file: \n" + err.Error())
+    }
+
+    return suppress
+}
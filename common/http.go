@@ -0,0 +1,117 @@
+package common
+
+import (
+    "os"
+    "sync"
+    "time"
+    "errors"
+    "net/http"
+    "crypto/tls"
+    "crypto/x509"
+)
+
+// TlsClient configures mutual TLS: a client certificate and key, and a CA
+// to verify the server with instead of the system CAs. All are PEM files.
+type TlsClient struct {
+    Cert string
+    Key string
+    Ca string
+}
+
+// TLSTransport returns a transport presenting the client certificate, or
+// nil if none of the fields is set
+func TLSTransport(config TlsClient) (*http.Transport, error) {
+    if config.Cert == "" && config.Key == "" && config.Ca == "" {
+        return nil, nil
+    }
+
+    tlsConfig := &tls.Config{}
+
+    if config.Cert != "" || config.Key != "" {
+        cert, err := tls.LoadX509KeyPair(config.Cert, config.Key)
+        if err != nil {
+            return nil, err
+        }
+        tlsConfig.Certificates = []tls.Certificate{cert}
+    }
+
+    if config.Ca != "" {
+        caPem, err := os.ReadFile(config.Ca)
+        if err != nil {
+            return nil, err
+        }
+
+        pool := x509.NewCertPool()
+        if !pool.AppendCertsFromPEM(caPem) {
+            return nil, errors.New("no certificates found in " + config.Ca)
+        }
+        tlsConfig.RootCAs = pool
+    }
+
+    transport := http.DefaultTransport.(*http.Transport).Clone()
+    transport.TLSClientConfig = tlsConfig
+
+    return transport, nil
+}
+
+var redmineTransport http.RoundTripper
+var redmineTransportOnce sync.Once
+
+// RedmineHTTPClient returns the client for the Redmine API, using the
+// client certificate of redmine.tls if set
+func RedmineHTTPClient() *http.Client {
+    redmineTransportOnce.Do(func() {
+        transport, err := TLSTransport(Config.Redmine.Tls)
+        if err != nil {
+            LogError("Error loading the Redmine TLS config: " + err.Error())
+        }
+        if transport != nil {
+            redmineTransport = transport
+        }
+    })
+
+    return HTTPClient(10 * time.Second, redmineTransport)
+}
+
+// UserAgent identifies monokit and the host in outbound HTTP requests,
+// unless overridden with user_agent
+func UserAgent() string {
+    if Config.User_Agent != "" {
+        return Config.User_Agent
+    }
+
+    userAgent := "monokit/" + MonokitVersion
+
+    if Config.Identifier != "" {
+        userAgent += " (" + Config.Identifier + ")"
+    }
+
+    return userAgent
+}
+
+type userAgentTransport struct {
+    base http.RoundTripper
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+    if req.Header.Get("User-Agent") == "" {
+        req = req.Clone(req.Context())
+        req.Header.Set("User-Agent", UserAgent())
+    }
+
+    return t.base.RoundTrip(req)
+}
+
+// HTTPClient returns the client to use for outbound HTTP requests, it sets
+// the monokit User-Agent on every request. A timeout of 0 means no timeout,
+// a nil transport uses http.DefaultTransport.
+func HTTPClient(timeout time.Duration, transport http.RoundTripper) *http.Client {
+    if transport == nil {
+        transport = http.DefaultTransport
+    }
+
+    return &http.Client{
+        Timeout: timeout,
+        Transport: &userAgentTransport{base: transport},
+    }
+}
@@ -0,0 +1,61 @@
+package common
+
+import (
+    "os"
+    "time"
+    "strings"
+    "crypto/sha1"
+    "encoding/hex"
+)
+
+func incidentPath(service string) string {
+    return TmpDir + "/" + strings.Replace(service, "/", "-", -1) + "-incident.log"
+}
+
+// currentIncidentID returns the correlation ID of the current incident of
+// service, or an empty string if it has none
+func currentIncidentID(service string) string {
+    id, err := os.ReadFile(incidentPath(service))
+    if err != nil {
+        return ""
+    }
+    return strings.TrimSpace(string(id))
+}
+
+// IncidentID returns the correlation ID of the current incident of
+// service, starting a new incident if there is none. The same ID is put in
+// its alarms and its Redmine issue, so they can be found together. It
+// returns an empty string if alarm.correlation_ids is not set or the state
+// can't be kept.
+func IncidentID(service string) string {
+    if !Config.Alarm.Correlation_Ids || StateDegraded {
+        return ""
+    }
+
+    if id := currentIncidentID(service); id != "" {
+        return id
+    }
+
+    sum := sha1.Sum([]byte(Config.Identifier + "|" + ScriptName + "|" + service + "|" + time.Now().Format(time.RFC3339Nano)))
+    id := "inc-" + hex.EncodeToString(sum[:])[:8]
+
+    if err := AtomicWriteFile(incidentPath(service), []byte(id), 0644); err != nil {
+        LogError("Error writing the incident ID: \n" + err.Error())
+        return ""
+    }
+
+    return id
+}
+
+// EndIncident forgets the correlation ID of service once it recovered
+func EndIncident(service string) {
+    os.Remove(incidentPath(service))
+}
+
+// withIncident appends the correlation ID to message if there is one
+func withIncident(message string, id string) string {
+    if id == "" {
+        return message
+    }
+    return message + " [" + id + "]"
+}
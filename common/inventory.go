@@ -0,0 +1,213 @@
+package common
+
+import (
+    "os"
+    "fmt"
+    "time"
+    "bytes"
+    "context"
+    "os/exec"
+    "strings"
+    "runtime"
+    "net/http"
+    "encoding/json"
+    "github.com/spf13/cobra"
+    "github.com/shirou/gopsutil/v4/host"
+)
+
+var InventoryCmd = &cobra.Command{
+    Use: "inventory",
+    Short: "Print the host facts for a CMDB, or post them to inventory.url",
+    Run: func(cmd *cobra.Command, args []string) {
+        Init()
+        post, _ := cmd.Flags().GetBool("post")
+
+        if post {
+            if err := InventoryPost(); err != nil {
+                LogError("Error posting the inventory: " + err.Error())
+                os.Exit(1)
+            }
+            return
+        }
+
+        jsonData, err := json.MarshalIndent(CollectInventory(), "", "  ")
+        if err != nil {
+            LogError("Error encoding the inventory: " + err.Error())
+            os.Exit(1)
+        }
+
+        fmt.Println(string(jsonData))
+    },
+}
+
+type InventoryOs struct {
+    Platform string `json:"platform"`
+    Version string `json:"version"`
+    Kernel string `json:"kernel"`
+    Arch string `json:"arch"`
+}
+
+type InventoryComponent struct {
+    Name string `json:"name"`
+    LastRun string `json:"last_run,omitempty"`
+}
+
+type Inventory struct {
+    Identifier string `json:"identifier"`
+    Hostname string `json:"hostname"`
+    MonokitVersion string `json:"monokit_version"`
+    Os InventoryOs `json:"os"`
+    Components []InventoryComponent `json:"components"`
+    Products map[string]string `json:"products"`
+    Generated string `json:"generated"`
+}
+
+// productVersionCommands are run to get the versions of the products found
+// on the host, the first line of the output is used
+var productVersionCommands = map[string][]string{
+    "postfix": {"postconf", "-h", "mail_version"},
+    "pmg": {"pmgversion"},
+    "mysql": {"mysqld", "--version"},
+    "mariadb": {"mariadbd", "--version"},
+    "postgresql": {"postgres", "--version"},
+    "redis": {"redis-server", "--version"},
+    "nginx": {"nginx", "-v"},
+    "traefik": {"traefik", "version"},
+    "pritunl": {"pritunl", "version"},
+}
+
+// productVersions runs the version commands of the installed products
+func productVersions() map[string]string {
+    versions := make(map[string]string)
+
+    for product, command := range productVersionCommands {
+        if _, err := exec.LookPath(command[0]); err != nil {
+            continue
+        }
+
+        ctx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
+        stdout, stderr, err := Runner.Run(ctx, command[0], command[1:]...)
+        cancel()
+
+        // Some of them, eg. nginx, print the version to stderr
+        output := strings.TrimSpace(stdout)
+        if output == "" {
+            output = strings.TrimSpace(stderr)
+        }
+
+        if err != nil || output == "" {
+            continue
+        }
+
+        versions[product] = strings.SplitN(output, "\n", 2)[0]
+    }
+
+    return versions
+}
+
+// CollectInventory gathers the facts of the host, the components that ran
+// on it and when they last did
+func CollectInventory() Inventory {
+    inventory := Inventory{
+        Identifier: Config.Identifier,
+        MonokitVersion: MonokitVersion,
+        Os: InventoryOs{Arch: runtime.GOARCH},
+        Products: productVersions(),
+        Generated: time.Now().Format(time.RFC3339),
+    }
+
+    inventory.Hostname, _ = os.Hostname()
+
+    if info, err := host.Info(); err == nil {
+        inventory.Os.Platform = info.Platform
+        inventory.Os.Version = info.PlatformVersion
+        inventory.Os.Kernel = info.KernelVersion
+        if info.KernelArch != "" {
+            inventory.Os.Arch = info.KernelArch
+        }
+    } else {
+        inventory.Os.Platform = runtime.GOOS
+    }
+
+    for _, name := range InstalledComponents() {
+        component := InventoryComponent{Name: name}
+
+        // Written by Init on every run of the component
+        if lastRun, err := os.ReadFile(LastRunPath(name)); err == nil {
+            component.LastRun = strings.TrimSpace(string(lastRun))
+        }
+
+        inventory.Components = append(inventory.Components, component)
+    }
+
+    return inventory
+}
+
+// InventoryPost posts the inventory to inventory.url
+func InventoryPost() error {
+    if Config.Inventory.Url == "" {
+        return fmt.Errorf("inventory.url is not set")
+    }
+
+    jsonData, err := json.Marshal(CollectInventory())
+    if err != nil {
+        return err
+    }
+
+    req, err := http.NewRequest("POST", Config.Inventory.Url, bytes.NewBuffer(jsonData))
+    if err != nil {
+        return err
+    }
+
+    req.Header.Set("Content-Type", "application/json")
+    if Config.Inventory.Api_Key != "" {
+        req.Header.Set("Authorization", "Bearer " + Config.Inventory.Api_Key)
+    }
+
+    resp, err := HTTPClient(10 * time.Second, nil).Do(req)
+    if err != nil {
+        return err
+    }
+
+    defer resp.Body.Close()
+
+    if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+        return fmt.Errorf("unexpected status %s", resp.Status)
+    }
+
+    return nil
+}
+
+func inventoryPostedPath() string {
+    return TmpBaseDir + "inventory-posted"
+}
+
+// InventoryReport posts the inventory if inventory.url is set and it wasn't
+// posted in the last inventory.interval_hours, the daemon calls it after
+// each run.
+func InventoryReport() {
+    if Config.Inventory.Url == "" {
+        return
+    }
+
+    interval := Config.Inventory.Interval_Hours
+    if interval == 0 {
+        interval = 24
+    }
+
+    if posted, err := os.ReadFile(inventoryPostedPath()); err == nil {
+        postedTime, err := time.Parse(time.RFC3339, strings.TrimSpace(string(posted)))
+        if err == nil && time.Since(postedTime).Hours() < interval {
+            return
+        }
+    }
+
+    if err := InventoryPost(); err != nil {
+        LogError("Error posting the inventory: " + err.Error())
+        return
+    }
+
+    if err := AtomicWriteFile(inventoryPostedPath(), []byte(time.Now().Format(time.RFC3339)), 0644); err != nil {
+        LogError("Error writing " + inventoryPostedPath() + ": " + err.Error())
+    }
+}
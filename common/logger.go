@@ -1,7 +1,9 @@
 package common
 
 import (
+    "io"
     "os"
+    "bytes"
     "fmt"
     "path"
     "runtime"
@@ -9,7 +11,45 @@ import (
     "github.com/sirupsen/logrus"
 )
 
+// LogFormat is set from MONOKIT_LOG_FORMAT: "json" logs JSON to stdout
+// only, "console" prints the errors to stdout only and "both" (default)
+// prints them and logs JSON to the log file.
+var LogFormat = "both"
+
+// Verbose and Quiet are set through the --verbose and --quiet flags, they
+// override MONOKIT_LOG_LEVEL for the run with debug and warn respectively
+var Verbose bool
+var Quiet bool
+
+// logLevel returns the level from the flags or MONOKIT_LOG_LEVEL, info by
+// default
+func logLevel() logrus.Level {
+    switch {
+    case Verbose:
+        return logrus.DebugLevel
+    case Quiet:
+        return logrus.WarnLevel
+    }
+
+    if env := os.Getenv("MONOKIT_LOG_LEVEL"); env != "" {
+        level, err := logrus.ParseLevel(env)
+        if err == nil {
+            return level
+        }
+        fmt.Println(Fail + "Unknown MONOKIT_LOG_LEVEL '" + env + "', expected debug, info, warn or error" + Reset)
+    }
+
+    return logrus.InfoLevel
+}
+
 func LogInit(userMode bool) {
+    switch format := os.Getenv("MONOKIT_LOG_FORMAT"); format {
+    case "json", "console", "both":
+        LogFormat = format
+    case "":
+    default:
+        fmt.Println(Fail + "Unknown MONOKIT_LOG_FORMAT '" + format + "', expected json, console or both" + Reset)
+    }
 
     logfilePath := "/var/log/monokit.log"
 
@@ -25,6 +65,7 @@ func LogInit(userMode bool) {
         }
 
         logfilePath = xdgStateHome + "/monokit/monokit.log"
+        AuditLogPath = xdgStateHome + "/monokit/monokit-audit.log"
     }
 
     logrus.SetReportCaller(true)
@@ -36,19 +77,90 @@ func LogInit(userMode bool) {
         },                                                                           
     })
 
-    logFile, err := os.OpenFile(logfilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+    switch LogFormat {
+    case "json":
+        logrus.SetOutput(os.Stdout)
+    case "console":
+        logrus.SetOutput(io.Discard)
+    default:
+        pruneLogFileBySize(logfilePath, logMaxSize())
+
+        logFile, err := os.OpenFile(logfilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+        if err != nil {
+            panic(err)
+        }
+
+        logrus.SetOutput(logFile)
+    }
+
+    logrus.SetLevel(logLevel())
+}
+
+// logMaxSize returns MONOKIT_LOG_MAX_SIZE_MB in bytes, 100 MB by default.
+// 0 disables the limit.
+func logMaxSize() int64 {
+    maxSizeMb := int64(100)
+
+    if env := os.Getenv("MONOKIT_LOG_MAX_SIZE_MB"); env != "" {
+        parsed, err := strconv.ParseInt(env, 10, 64)
+        if err != nil || parsed < 0 {
+            fmt.Println(Fail + "Invalid MONOKIT_LOG_MAX_SIZE_MB '" + env + "', using the default of 100" + Reset)
+        } else {
+            maxSizeMb = parsed
+        }
+    }
+
+    return maxSizeMb * 1024 * 1024
+}
+
+// pruneLogFileBySize keeps the last maxSize/2 bytes of the log file, from
+// the first full line in them, once it is larger than maxSize. It is
+// truncated in place rather than replaced, so other processes appending to
+// it keep writing to the same file.
+func pruneLogFileBySize(logfilePath string, maxSize int64) {
+    if maxSize <= 0 {
+        return
+    }
+
+    info, err := os.Stat(logfilePath)
+    if err != nil || info.Size() <= maxSize {
+        return
+    }
+
+    file, err := os.OpenFile(logfilePath, os.O_RDWR, 0666)
     if err != nil {
-        panic(err)
+        fmt.Println(Fail + "Error opening the log file to prune it: " + err.Error() + Reset)
+        return
     }
+    defer file.Close()
 
-    logrus.SetOutput(logFile)
+    keep := make([]byte, maxSize / 2)
+    n, err := file.ReadAt(keep, info.Size() - int64(len(keep)))
+    if err != nil && err != io.EOF {
+        fmt.Println(Fail + "Error reading the log file to prune it: " + err.Error() + Reset)
+        return
+    }
+    keep = keep[:n]
 
-    logrus.SetLevel(logrus.InfoLevel)
-    
+    // Start at a line boundary
+    if i := bytes.IndexByte(keep, '\n'); i >= 0 {
+        keep = keep[i+1:]
+    }
+
+    if err := file.Truncate(0); err != nil {
+        fmt.Println(Fail + "Error truncating the log file: " + err.Error() + Reset)
+        return
+    }
+
+    if _, err := file.WriteAt(keep, 0); err != nil {
+        fmt.Println(Fail + "Error writing the pruned log file: " + err.Error() + Reset)
+    }
 }
 
 func LogError(err string) {
-    fmt.Println(Fail + err + Reset)
+    if LogFormat != "json" {
+        fmt.Println(Fail + err + Reset)
+    }
     logrus.Error(err)
 }
 
@@ -63,7 +175,16 @@ func PrettyPrintStr(name string, lessOrMore bool, value string) {
         not = "not "
     }
 
-    fmt.Println(Blue + name + Reset + " is " + not + color + value + Reset)
+    Println(Blue + name + Reset + " is " + not + color + value + Reset)
+}
+
+// PrintCheckFailed shows that the check of name couldn't collect its data,
+// so a failed check isn't mistaken for an empty or healthy section, and
+// exits with ExitCheckFailed at the end of the run.
+func PrintCheckFailed(name string, reason string) {
+    SetExitCode(ExitCheckFailed)
+    Println(Blue + name + Reset + " " + Fail + "⚠ check failed: " + reason + Reset)
+    logrus.Error(name + ": " + reason)
 }
 
 func PrettyPrint(name string, lessOrMore string, value float64, hasPercentage bool, wantFloat bool, enableLimit bool, limit float64) {
@@ -98,5 +219,5 @@ func PrettyPrint(name string, lessOrMore string, value float64, hasPercentage bo
         final = final + strconv.FormatFloat(value, 'f', floatDepth, 64) + "/" + strconv.FormatFloat(limit, 'f', 0, 64) + Reset 
     }
 
-    fmt.Println(final)
+    Println(final)
 }   
@@ -0,0 +1,276 @@
+package common
+
+import (
+    "io"
+    "os"
+    "fmt"
+    "time"
+    "bufio"
+    "regexp"
+    "strings"
+    "github.com/monobilisim/monokit/common"
+    issues "github.com/monobilisim/monokit/common/redmine/issues"
+)
+
+// bounceHistoryMaxAge is how long the bounce samples are kept for the trend
+const bounceHistoryMaxAge = 7 * 24 * time.Hour
+
+type BounceRate struct {
+    Enabled bool
+    Log_File string
+    Window_Minutes float64
+    Limit float64
+    Min_Messages int
+}
+
+type BounceStats struct {
+    Time string `json:"time"`
+    Sent int `json:"sent"`
+    Bounced int `json:"bounced"`
+    Ratio float64 `json:"ratio"`
+}
+
+var (
+    postfixStatusRegex = regexp.MustCompile(`postfix/\S+\[\d+\]: [0-9A-Za-z]+: to=.*\bstatus=(sent|bounced)\b`)
+    // Relays to the content filters and back, eg. amavis or pmg-smtp-filter, the
+    // message is counted once it is delivered from there
+    contentFilterRegex = regexp.MustCompile(`relay=127\.0\.0\.1\[127\.0\.0\.1\]:100\d\d\b`)
+)
+
+// logLineTime parses the timestamp of a syslog line, both the traditional
+// "Oct 16 13:22:06" and the RFC3339 formats
+func logLineTime(line string, now time.Time) (time.Time, bool) {
+    fields := strings.Fields(line)
+    if len(fields) == 0 {
+        return time.Time{}, false
+    }
+
+    if t, err := time.Parse(time.RFC3339Nano, fields[0]); err == nil {
+        return t, true
+    }
+
+    if len(fields) < 3 {
+        return time.Time{}, false
+    }
+
+    t, err := time.ParseInLocation("Jan 2 15:04:05 2006", fields[0] + " " + fields[1] + " " + fields[2] + " " + fmt.Sprint(now.Year()), time.Local)
+    if err != nil {
+        return time.Time{}, false
+    }
+
+    // The year is not logged, a date after now is from the last year
+    if t.After(now.Add(time.Hour)) {
+        t = t.AddDate(-1, 0, 0)
+    }
+
+    return t, true
+}
+
+// bounceStateVersion is the schema version of the bounce state
+const bounceStateVersion = 1
+
+// bounceBucket counts the messages delivered and bounced in the minute or
+// hour starting at Start
+type bounceBucket struct {
+    Start time.Time `json:"start"`
+    Sent int `json:"sent"`
+    Bounced int `json:"bounced"`
+}
+
+// bounceState is what has been read of the mail log. Offset is where the
+// next run continues reading, Minutes are the counts of the last window and
+// Hours the counts kept for the trend.
+type bounceState struct {
+    Offset int64 `json:"offset"`
+    Minutes []bounceBucket `json:"minutes"`
+    Hours []bounceBucket `json:"hours"`
+}
+
+func bounceStatePath() string {
+    return common.TmpDir + "/bounce-state.json"
+}
+
+// addBounce counts a message in the bucket starting at start, the log is
+// mostly in order so the bucket is looked for from the end
+func addBounce(buckets []bounceBucket, start time.Time, bounced bool) []bounceBucket {
+    i := len(buckets) - 1
+    for i >= 0 && !buckets[i].Start.Equal(start) {
+        i--
+    }
+
+    if i < 0 {
+        buckets = append(buckets, bounceBucket{Start: start})
+        i = len(buckets) - 1
+    }
+
+    if bounced {
+        buckets[i].Bounced++
+    } else {
+        buckets[i].Sent++
+    }
+
+    return buckets
+}
+
+// bucketsSince returns the buckets starting at or after since
+func bucketsSince(buckets []bounceBucket, since time.Time) []bounceBucket {
+    var kept []bounceBucket
+    for _, bucket := range buckets {
+        if !bucket.Start.Before(since) {
+            kept = append(kept, bucket)
+        }
+    }
+    return kept
+}
+
+// readBounces counts the messages logged by postfix after state.Offset.
+// Only the complete lines are read, a line still being written is read on
+// the next run. The log is read from the start again when it is smaller
+// than the offset, ie. it has been rotated.
+func readBounces(logFile string, state *bounceState, now time.Time) error {
+    file, err := os.Open(logFile)
+    if err != nil {
+        return err
+    }
+
+    defer file.Close()
+
+    info, err := file.Stat()
+    if err != nil {
+        return err
+    }
+
+    if info.Size() < state.Offset {
+        state.Offset = 0
+    }
+
+    if _, err := file.Seek(state.Offset, io.SeekStart); err != nil {
+        return err
+    }
+
+    trendSince := now.Add(-bounceHistoryMaxAge)
+    reader := bufio.NewReaderSize(file, 64 * 1024)
+
+    for {
+        line, err := reader.ReadString('\n')
+        if err == io.EOF {
+            return nil
+        }
+        if err != nil {
+            return err
+        }
+
+        state.Offset += int64(len(line))
+
+        match := postfixStatusRegex.FindStringSubmatch(line)
+        if match == nil || contentFilterRegex.MatchString(line) {
+            continue
+        }
+
+        t, ok := logLineTime(line, now)
+        if !ok || t.Before(trendSince) {
+            continue
+        }
+
+        bounced := match[1] == "bounced"
+        state.Minutes = addBounce(state.Minutes, t.Truncate(time.Minute), bounced)
+        state.Hours = addBounce(state.Hours, t.Truncate(time.Hour), bounced)
+    }
+}
+
+// bounceStats counts the delivered and bounced messages logged by postfix
+// in the last window and over the last bounceHistoryMaxAge, which is the
+// ratio of the bounced messages, -1 if there were none. Only the part of
+// the log written since the previous run is read.
+func bounceStats(logFile string, window time.Duration) (BounceStats, float64, error) {
+    now := time.Now()
+    stats := BounceStats{Time: now.Format(time.RFC3339)}
+
+    var state bounceState
+    common.LoadCache(bounceStatePath(), bounceStateVersion, &state)
+
+    if err := readBounces(logFile, &state, now); err != nil {
+        return stats, -1, err
+    }
+
+    state.Minutes = bucketsSince(state.Minutes, now.Add(-window).Truncate(time.Minute))
+    state.Hours = bucketsSince(state.Hours, now.Add(-bounceHistoryMaxAge).Truncate(time.Hour))
+
+    if err := common.SaveCache(bounceStatePath(), bounceStateVersion, state); err != nil {
+        common.LogError("Error writing the bounce state: " + err.Error())
+    }
+
+    for _, bucket := range state.Minutes {
+        stats.Sent += bucket.Sent
+        stats.Bounced += bucket.Bounced
+    }
+
+    if total := stats.Sent + stats.Bounced; total > 0 {
+        stats.Ratio = float64(stats.Bounced) / float64(total) * 100
+    }
+
+    trendSent, trendBounced := 0, 0
+    for _, bucket := range state.Hours {
+        trendSent += bucket.Sent
+        trendBounced += bucket.Bounced
+    }
+
+    if trendSent + trendBounced == 0 {
+        return stats, -1, nil
+    }
+
+    return stats, float64(trendBounced) / float64(trendSent + trendBounced) * 100, nil
+}
+
+// CheckBounceRate alarms when more than Limit percent of the messages
+// delivered in the last Window_Minutes bounced, which is usually a
+// compromised account sending spam or a broken configuration. defaultLog
+// is used when Log_File is not set.
+func CheckBounceRate(config BounceRate, defaultLog string) (BounceStats, error) {
+    logFile := config.Log_File
+    if logFile == "" {
+        logFile = defaultLog
+    }
+
+    window := config.Window_Minutes
+    if window == 0 {
+        window = 60
+    }
+
+    limit := config.Limit
+    if limit == 0 {
+        limit = 10
+    }
+
+    minMessages := config.Min_Messages
+    if minMessages == 0 {
+        minMessages = 20
+    }
+
+    stats, ratio, err := bounceStats(logFile, time.Duration(window * float64(time.Minute)))
+    if err != nil {
+        common.LogError("Error reading " + logFile + ": " + err.Error())
+        return stats, err
+    }
+
+    trend := "n/a"
+    if ratio >= 0 {
+        trend = fmt.Sprintf("%.1f%%", ratio)
+    }
+
+    rate := fmt.Sprintf("%.1f%% (%d/%d in %.0f minutes, 7 day average %s)", stats.Ratio, stats.Bounced, stats.Sent + stats.Bounced, window, trend)
+
+    // Too few messages for the ratio to mean anything
+    if stats.Sent + stats.Bounced < minMessages || stats.Ratio <= limit {
+        common.PrettyPrintStr("Bounce rate", true, "acceptable, " + rate)
+        common.AlarmCheckUp("bounce_rate", "Bounce rate is acceptable again - " + rate, false)
+        issues.CheckUp("bounce_rate", "Geri dönen mesaj oranı normale döndü: " + rate)
+        return stats, nil
+    }
+
+    common.PrettyPrintStr("Bounce rate", false, "acceptable, " + rate)
+    common.AlarmCheckDown("bounce_rate", "Bounce rate is above " + fmt.Sprint(limit) + "% - " + rate, false)
+    issues.CheckDown("bounce_rate", common.Config.Identifier + " için geri dönen mesaj oranı yüksek", "Geri dönen mesaj oranı: " + rate + "\nLimit: %" + fmt.Sprint(limit) + "\n\nEle geçirilmiş bir hesap ya da hatalı bir yapılandırma olabilir.", false, 0)
+
+    return stats, nil
+}
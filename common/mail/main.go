@@ -6,18 +6,127 @@ type Postal struct {
     Check_Message bool
 }
 
+// ConfirmAfter is the grace before a down service is alarmed, the number
+// of consecutive checks or minutes it has to be down for
+type ConfirmAfter struct {
+    Checks int
+    Minutes float64
+}
+
 type Zimbra struct {
     Z_Url string
     Restart bool
     Queue_Limit int
+    Queue_Clear int
+    Queue_Rate_Limit float64
     Restart_Limit int
+    Command_Retries int
+    Advisory_Services []string
+    Ignore_Services []string
+    Confirm_After ConfirmAfter
+    Allow_Destructive_Actions bool
+    Manage_Nginx_Template bool
+
+    Mail_Ports struct {
+        Enabled bool
+        Host string
+        Ports []int
+        Banner bool
+        Timeout_Ms int
+    }
+
+    Amavis struct {
+        Enabled bool
+        Backlog_Limit int
+    }
+
+    Jvm_Heap struct {
+        Enabled bool
+        Limit float64
+        Confirm_After ConfirmAfter
+    }
+
+    Accounts struct {
+        Enabled bool
+        Schedule string
+        Seat_Cap int
+        // A list as viper splits the map keys at the dots of the domains
+        Domain_Seat_Caps []struct {
+            Domain string
+            Seats int
+        }
+        Warn_Percent float64
+    }
+
+    Mailboxes struct {
+        Enabled bool
+        Spike_Limit int
+        Spike_Hours float64
+        Cache_Minutes float64
+    }
+
+    Backup struct {
+        Enabled bool
+        Path string
+        Max_Hours float64
+    }
+
+    Zmfixperms struct {
+        Enabled bool
+        Schedule string
+        Max_Per_Day int
+        Catch_Up_Hours float64
+    }
+
+    Cache_Failure struct {
+        Confirm_After ConfirmAfter
+        Redmine bool
+    }
 }
 
 type Pmg struct {
     Queue_Limit int
+    Queue_Clear int
+    Advisory_Services []string
+    Confirm_After ConfirmAfter
+
+    Rbl struct {
+        Enabled bool
+        Lists []string
+        Public_Ips []string
+        Cache_Minutes float64
+        Query_Delay_Ms int
+    }
+
+    Cluster struct {
+        Enabled bool
+    }
+
+    Filter struct {
+        Confirm_After ConfirmAfter
+    }
+
+    Cert struct {
+        Enabled bool
+        Hosts []string
+        Ports []int
+        Expiry_Days int
+    }
+
+    Rule_Freshness struct {
+        Max_Days float64
+        Paths []string
+    }
+
+    Disk struct {
+        Paths []string
+        Part_Use_Limit float64
+    }
 }
 
 type MailHealth struct {
+    Tls_Audit TlsAudit
+    Bounce_Rate BounceRate
     Postal Postal
     Zimbra Zimbra
     Pmg Pmg
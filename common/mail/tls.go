@@ -0,0 +1,286 @@
+package common
+
+import (
+    "net"
+    "time"
+    "bufio"
+    "errors"
+    "strconv"
+    "strings"
+    "net/smtp"
+    "crypto/tls"
+    "crypto/x509"
+    "github.com/monobilisim/monokit/common"
+)
+
+type TlsAudit struct {
+    Enabled bool
+    Host string
+    Ports []int
+    Interval_Hours float64
+}
+
+type TLSAuditInfo struct {
+    Host string
+    Port int
+    Versions []string
+    Ciphers []string
+    WeakVersions []string
+    WeakCiphers []string
+    Error string
+}
+
+var tlsVersions = []uint16{tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13}
+
+var tlsAuditTimeout = 5 * time.Second
+
+// tlsAuditCacheVersion is the schema version of the TLS audit cache
+const tlsAuditCacheVersion = 1
+
+type tlsAuditResult struct {
+    Info TLSAuditInfo `json:"info"`
+    Checked string `json:"checked"`
+}
+
+func tlsAuditCachePath() string {
+    return common.TmpDir + "/tls_audit.json"
+}
+
+func isWeakVersion(version uint16) bool {
+    return version < tls.VersionTLS12
+}
+
+func isWeakCipher(id uint16) bool {
+    for _, suite := range tls.InsecureCipherSuites() {
+        if suite.ID == id {
+            return true
+        }
+    }
+    return false
+}
+
+func startTLSImap(conn net.Conn) error {
+    reader := bufio.NewReader(conn)
+
+    // Greeting
+    if _, err := reader.ReadString('\n'); err != nil {
+        return err
+    }
+
+    if _, err := conn.Write([]byte("a1 STARTTLS\r\n")); err != nil {
+        return err
+    }
+
+    for {
+        line, err := reader.ReadString('\n')
+        if err != nil {
+            return err
+        }
+
+        if strings.HasPrefix(line, "a1 OK") {
+            return nil
+        }
+
+        if strings.HasPrefix(line, "a1 ") {
+            return errors.New("STARTTLS refused: " + strings.TrimSpace(line))
+        }
+    }
+}
+
+// tlsHandshake connects to host:port and negotiates TLS with the given
+// config, using STARTTLS on the plaintext SMTP and IMAP ports.
+func tlsHandshake(host string, port int, config *tls.Config) (tls.ConnectionState, error) {
+    conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), tlsAuditTimeout)
+    if err != nil {
+        return tls.ConnectionState{}, err
+    }
+    defer conn.Close()
+
+    conn.SetDeadline(time.Now().Add(tlsAuditTimeout))
+
+    switch port {
+    case 25, 587:
+        client, err := smtp.NewClient(conn, host)
+        if err != nil {
+            return tls.ConnectionState{}, err
+        }
+
+        if err := client.StartTLS(config); err != nil {
+            return tls.ConnectionState{}, err
+        }
+
+        state, _ := client.TLSConnectionState()
+        return state, nil
+    case 143:
+        if err := startTLSImap(conn); err != nil {
+            return tls.ConnectionState{}, err
+        }
+    }
+
+    tlsConn := tls.Client(conn, config)
+    if err := tlsConn.Handshake(); err != nil {
+        return tls.ConnectionState{}, err
+    }
+
+    return tlsConn.ConnectionState(), nil
+}
+
+// PeerCertificate returns the certificate served on host:port, it is not
+// verified so expired certificates can still be inspected.
+func PeerCertificate(host string, port int) (*x509.Certificate, error) {
+    state, err := tlsHandshake(host, port, &tls.Config{ServerName: host, InsecureSkipVerify: true})
+    if err != nil {
+        return nil, err
+    }
+
+    if len(state.PeerCertificates) == 0 {
+        return nil, errors.New("no certificates found")
+    }
+
+    return state.PeerCertificates[0], nil
+}
+
+// AuditTLS enumerates the protocol versions and cipher suites offered on
+// host:port. Only the cipher suites known to crypto/tls can be detected.
+func AuditTLS(host string, port int) (TLSAuditInfo, error) {
+    info := TLSAuditInfo{Host: host, Port: port}
+    var lastErr error
+
+    for _, version := range tlsVersions {
+        state, err := tlsHandshake(host, port, &tls.Config{
+            ServerName: host,
+            InsecureSkipVerify: true,
+            MinVersion: version,
+            MaxVersion: version,
+        })
+
+        if err != nil {
+            lastErr = err
+            continue
+        }
+
+        name := tls.VersionName(version)
+        info.Versions = append(info.Versions, name)
+
+        if isWeakVersion(version) {
+            info.WeakVersions = append(info.WeakVersions, name)
+        }
+
+        // TLS 1.3 cipher suites are not configurable, record the negotiated one
+        if version == tls.VersionTLS13 {
+            info.Ciphers = append(info.Ciphers, tls.CipherSuiteName(state.CipherSuite))
+        }
+    }
+
+    if len(info.Versions) == 0 {
+        return info, lastErr
+    }
+
+    suites := append(tls.CipherSuites(), tls.InsecureCipherSuites()...)
+
+    for _, suite := range suites {
+        maxVersion := uint16(0)
+        for _, version := range suite.SupportedVersions {
+            if version <= tls.VersionTLS12 && version > maxVersion {
+                maxVersion = version
+            }
+        }
+
+        if maxVersion == 0 {
+            continue
+        }
+
+        _, err := tlsHandshake(host, port, &tls.Config{
+            ServerName: host,
+            InsecureSkipVerify: true,
+            MinVersion: tls.VersionTLS10,
+            MaxVersion: maxVersion,
+            CipherSuites: []uint16{suite.ID},
+        })
+
+        if err != nil {
+            continue
+        }
+
+        info.Ciphers = append(info.Ciphers, suite.Name)
+
+        if isWeakCipher(suite.ID) {
+            info.WeakCiphers = append(info.WeakCiphers, suite.Name)
+        }
+    }
+
+    return info, nil
+}
+
+// CheckTLSAudit audits the configured ports and alarms when weak TLS is
+// enabled on any of them. A port takes a handshake per version and cipher
+// suite, so the results are cached and the ports are only audited again
+// every Interval_Hours. Failed audits are retried on the next run.
+func CheckTLSAudit(config TlsAudit) []TLSAuditInfo {
+    host := config.Host
+    if host == "" {
+        host = "127.0.0.1"
+    }
+
+    ports := config.Ports
+    if len(ports) == 0 {
+        ports = []int{587, 993}
+    }
+
+    intervalHours := config.Interval_Hours
+    if intervalHours == 0 {
+        intervalHours = 24
+    }
+
+    cache := make(map[string]tlsAuditResult)
+    if !common.LoadCache(tlsAuditCachePath(), tlsAuditCacheVersion, &cache) || cache == nil {
+        cache = make(map[string]tlsAuditResult)
+    }
+
+    var infos []TLSAuditInfo
+
+    for _, port := range ports {
+        portStr := strconv.Itoa(port)
+        service := "tls_audit_" + portStr
+        key := net.JoinHostPort(host, portStr)
+
+        result, cached := cache[key]
+        checked, err := time.Parse(time.RFC3339, result.Checked)
+
+        info := result.Info
+        if !cached || err != nil || time.Since(checked).Hours() >= intervalHours {
+            info, err = AuditTLS(host, port)
+            if err != nil {
+                info.Error = err.Error()
+                infos = append(infos, info)
+                delete(cache, key)
+                common.PrintCheckFailed("Port " + portStr + " TLS", info.Error)
+                continue
+            }
+
+            cache[key] = tlsAuditResult{Info: info, Checked: time.Now().Format(time.RFC3339)}
+        }
+
+        infos = append(infos, info)
+
+        common.PrettyPrintStr("Port " + portStr + " TLS versions", true, strings.Join(info.Versions, ", "))
+
+        if len(info.WeakVersions) > 0 || len(info.WeakCiphers) > 0 {
+            var weak []string
+            weak = append(weak, info.WeakVersions...)
+            weak = append(weak, info.WeakCiphers...)
+
+            common.PrettyPrintStr("Port " + portStr + " weak TLS", false, "disabled")
+            common.AlarmCheckDown(service, "Weak TLS is enabled on " + host + ":" + portStr + ": " + strings.Join(weak, ", "), false)
+        } else {
+            common.PrettyPrintStr("Port " + portStr + " weak TLS", true, "disabled")
+            common.AlarmCheckUp(service, "Weak TLS is no longer enabled on " + host + ":" + portStr, false)
+        }
+    }
+
+    if err := common.SaveCache(tlsAuditCachePath(), tlsAuditCacheVersion, cache); err != nil {
+        common.LogError("Error writing the TLS audit cache: " + err.Error())
+    }
+
+    return infos
+}
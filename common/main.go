@@ -3,8 +3,10 @@ package common
 import ( 
     "os"
     "fmt"
+    "path/filepath"
     "bufio"
     "unicode"
+    "github.com/sirupsen/logrus"
 )
 
 var Config Common
@@ -12,8 +14,8 @@ var TmpPath string
 var MonokitVersion = "devel"
 
 func SplitSection(section string) {
-    fmt.Println("\n" + section)
-    fmt.Println("--------------------------------------------------")
+    Println("\n" + section)
+    Println("--------------------------------------------------")
 }
 
 func ContainsUint32(a uint32, b []uint32) bool {
@@ -69,9 +71,24 @@ func ConvertBytes(bytes uint64) string {
     return fmt.Sprintf("%d %s", bytes, sizes[i])
 }
 
+// QuietFirstRun is set when this is the first run of the component and
+// alarm.quiet_first_run is enabled, the state is recorded but no alarms are
+// sent and no issues are created.
+var QuietFirstRun bool
+
 func Init() {
     var userMode bool = false
 
+    // Init runs for every component in the daemon, the previous one may
+    // have been on its first run
+    QuietFirstRun = false
+    cacheErrors = nil
+    resetRedmineCheck()
+
+    // The first run is decided by the component's own directory, TmpDir
+    // may be somewhere else, eg. for lbPolicy
+    firstRun := !FileExists(TmpBaseDir + ScriptName)
+
     // Check if user is root
     if os.Geteuid() != 0 {
         userMode = true
@@ -87,20 +104,67 @@ func Init() {
         }
 
     }
+
+    // Marks the component as seen and holds its last run when TmpDir is
+    // somewhere else
+    if !FileExists(TmpBaseDir + ScriptName) {
+        if err := os.MkdirAll(TmpBaseDir + ScriptName, 0755); err != nil {
+            fmt.Println("Error creating tmp directory: \n" + TmpBaseDir + ScriptName + "\n" + err.Error())
+        }
+    }
     
     LogInit(userMode)
     ConfInit("global", &Config)
+    ValidateIdentifier()
+
+    if firstRun && Config.Alarm.Quiet_First_Run {
+        QuietFirstRun = true
+        logrus.Info("First run of " + ScriptName + ", recording the baseline without sending alarms or creating issues")
+        Println(Blue + "First run, recording the baseline without sending alarms or creating issues" + Reset)
+    }
+    OutputInit()
+    checkStateDir()
+    checkStateStorage()
+    recordRun()
 }
 
-func WriteToFile(filename string, data string) error {
-        file, err := os.Create(filename)
-        if err != nil {
-                return err
-        }
-        defer file.Close()
+// AtomicWriteFile writes data to a temporary file in the same directory as
+// path, syncs it and renames it over path, so readers never see a partially
+// written file. The temporary file has a unique name, so concurrent or
+// retried writes to the same path don't clash.
+func AtomicWriteFile(path string, data []byte, perm os.FileMode) error {
+    tmp, err := os.CreateTemp(filepath.Dir(path), "." + filepath.Base(path) + ".tmp-*")
+    if err != nil {
+        return err
+    }
+
+    tmpName := tmp.Name()
+    // No-op once the file has been renamed
+    defer os.Remove(tmpName)
 
-        _, err = file.WriteString(data)
+    if _, err := tmp.Write(data); err != nil {
+        tmp.Close()
         return err
+    }
+
+    if err := tmp.Sync(); err != nil {
+        tmp.Close()
+        return err
+    }
+
+    if err := tmp.Close(); err != nil {
+        return err
+    }
+
+    if err := os.Chmod(tmpName, perm); err != nil {
+        return err
+    }
+
+    return os.Rename(tmpName, path)
+}
+
+func WriteToFile(filename string, data string) error {
+        return AtomicWriteFile(filename, []byte(data), 0644)
 }
 
 func IsInArray(a string, list []string) bool {
@@ -0,0 +1,103 @@
+package common
+
+import (
+    "net"
+    "sync"
+    "time"
+    "context"
+    "github.com/monobilisim/monokit/common"
+)
+
+// Resolver does DNS lookups with the servers, timeout and concurrency set
+// in the dns section of global.yml.
+type Resolver struct {
+    resolver *net.Resolver
+    timeout time.Duration
+    concurrency int
+
+    // Delay is the minimum time between starting two lookups, to stay
+    // below the rate limits of eg. DNSBLs
+    Delay time.Duration
+}
+
+type LookupResult struct {
+    Host string
+    Addrs []string
+    Err error
+}
+
+func NewResolver() *Resolver {
+    timeout := time.Duration(common.Config.Dns.Timeout_Ms) * time.Millisecond
+    if timeout == 0 {
+        timeout = 5 * time.Second
+    }
+
+    concurrency := common.Config.Dns.Concurrency
+    if concurrency <= 0 {
+        concurrency = 4
+    }
+
+    resolver := net.DefaultResolver
+
+    if servers := common.Config.Dns.Servers; len(servers) > 0 {
+        var next int
+        var mu sync.Mutex
+
+        resolver = &net.Resolver{
+            PreferGo: true,
+            Dial: func(ctx context.Context, network string, address string) (net.Conn, error) {
+                // Rotate through the configured servers
+                mu.Lock()
+                server := servers[next % len(servers)]
+                next++
+                mu.Unlock()
+
+                if _, _, err := net.SplitHostPort(server); err != nil {
+                    server = net.JoinHostPort(server, "53")
+                }
+
+                dialer := net.Dialer{Timeout: timeout}
+                return dialer.DialContext(ctx, network, server)
+            },
+        }
+    }
+
+    return &Resolver{resolver: resolver, timeout: timeout, concurrency: concurrency}
+}
+
+func (r *Resolver) LookupHost(host string) ([]string, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+    defer cancel()
+
+    return r.resolver.LookupHost(ctx, host)
+}
+
+// LookupHosts resolves hosts concurrently, returning the results in the
+// same order as hosts.
+func (r *Resolver) LookupHosts(hosts []string) []LookupResult {
+    results := make([]LookupResult, len(hosts))
+
+    var wg sync.WaitGroup
+    sem := make(chan struct{}, r.concurrency)
+
+    for i, host := range hosts {
+        if i > 0 && r.Delay > 0 {
+            time.Sleep(r.Delay)
+        }
+
+        sem <- struct{}{}
+        wg.Add(1)
+
+        go func(i int, host string) {
+            defer wg.Done()
+            defer func() { <-sem }()
+
+            addrs, err := r.LookupHost(host)
+            results[i] = LookupResult{Host: host, Addrs: addrs, Err: err}
+        }(i, host)
+    }
+
+    wg.Wait()
+
+    return results
+}
@@ -0,0 +1,87 @@
+package common
+
+import (
+    "io"
+    "os"
+    "fmt"
+    "regexp"
+    "strings"
+)
+
+// Output is where the rendered status of the components is written to,
+// set from Config.Output.Destination by Init.
+var Output io.Writer = os.Stdout
+
+// outputSet is whether OutputInit has set Output for the current run
+var outputSet bool
+
+// outputCloser closes the file or syslog connection Output writes to
+var outputCloser io.Closer
+
+var ansiRegex = regexp.MustCompile("\033\\[[0-9;]*m")
+
+// plainWriter removes the color codes before writing to w
+type plainWriter struct {
+    w io.Writer
+}
+
+func (p plainWriter) Write(b []byte) (int, error) {
+    _, err := p.w.Write(ansiRegex.ReplaceAll(b, nil))
+    return len(b), err
+}
+
+// OutputInit sets Output according to Config.Output.Destination, which is
+// one of stdout (default), file:<path> or syslog. It only does so once per
+// run, the file is truncated at the start of the run, so it holds the output
+// of all the components of the run.
+func OutputInit() {
+    if outputSet {
+        return
+    }
+    outputSet = true
+
+    destination := Config.Output.Destination
+
+    switch {
+    case destination == "" || destination == "stdout":
+        Output = os.Stdout
+    case strings.HasPrefix(destination, "file:"):
+        path := strings.TrimPrefix(destination, "file:")
+        file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+        if err != nil {
+            LogError("Error opening output file, using stdout: \n" + err.Error())
+            return
+        }
+        outputCloser = file
+        Output = plainWriter{file}
+    case destination == "syslog":
+        writer, err := syslogWriter()
+        if err != nil {
+            LogError("Error connecting to syslog, using stdout: \n" + err.Error())
+            return
+        }
+        if closer, ok := writer.(io.Closer); ok {
+            outputCloser = closer
+        }
+        Output = plainWriter{writer}
+    default:
+        LogError("Unknown output destination '" + destination + "', using stdout")
+    }
+}
+
+// OutputReset starts a new run, the next OutputInit sets Output again and
+// truncates the file. The daemon calls it before every run of the
+// components.
+func OutputReset() {
+    if outputCloser != nil {
+        outputCloser.Close()
+        outputCloser = nil
+    }
+    Output = os.Stdout
+    outputSet = false
+}
+
+// Println writes the rendered status to Output
+func Println(a ...interface{}) {
+    fmt.Fprintln(Output, a...)
+}
@@ -0,0 +1,12 @@
+//go:build windows || plan9
+
+package common
+
+import (
+    "io"
+    "errors"
+)
+
+func syslogWriter() (io.Writer, error) {
+    return nil, errors.New("syslog is not supported on this platform")
+}
@@ -0,0 +1,12 @@
+//go:build !windows && !plan9
+
+package common
+
+import (
+    "io"
+    "log/syslog"
+)
+
+func syslogWriter() (io.Writer, error) {
+    return syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, "monokit")
+}
@@ -0,0 +1,67 @@
+package common
+
+import (
+    "os"
+    "sync"
+    "time"
+    "strings"
+    "github.com/monobilisim/monokit/common"
+)
+
+type pendingClose struct {
+    service string
+    message string
+}
+
+var pendingCloses []pendingClose
+var pendingMu sync.Mutex
+
+func queueClose(service string, message string) {
+    pendingMu.Lock()
+    defer pendingMu.Unlock()
+
+    pendingCloses = append(pendingCloses, pendingClose{service, message})
+}
+
+// Flush closes the issues queued by CheckUp, redmine.close_concurrency at a
+// time. It has to be called at the end of a component's run, while TmpDir
+// still points to its directory.
+func Flush() {
+    pendingMu.Lock()
+    closes := pendingCloses
+    pendingCloses = nil
+    pendingMu.Unlock()
+
+    if len(closes) == 0 {
+        return
+    }
+
+    concurrency := common.Config.Redmine.Close_Concurrency
+    if concurrency < 1 {
+        concurrency = 1
+    }
+
+    delay := time.Duration(common.Config.Redmine.Request_Delay_Ms) * time.Millisecond
+
+    var wg sync.WaitGroup
+    sem := make(chan struct{}, concurrency)
+
+    for i, pending := range closes {
+        if i > 0 && delay > 0 {
+            time.Sleep(delay)
+        }
+
+        sem <- struct{}{}
+        wg.Add(1)
+
+        go func(pending pendingClose) {
+            defer wg.Done()
+            defer func() { <-sem }()
+
+            os.Remove(common.TmpDir + "/" + strings.Replace(pending.service, "/", "-", -1) + common.RedmineStatSuffix)
+            Close(pending.service, pending.message)
+        }(pending)
+    }
+
+    wg.Wait()
+}
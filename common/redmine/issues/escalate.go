@@ -0,0 +1,84 @@
+package common
+
+import (
+    "os"
+    "bytes"
+    "strconv"
+    "strings"
+    "net/http"
+    "encoding/json"
+    "github.com/monobilisim/monokit/common"
+)
+
+func priorityStatePath(service string) string {
+    return common.TmpDir + "/" + strings.Replace(service, "/", "-", -1) + "-redmine-priority.log"
+}
+
+// escalatePriority raises the priority of the issue of service once the
+// service reaches an escalation level with a Redmine priority
+func escalatePriority(service string) {
+    if common.Config.Redmine.Enabled == false {
+        return
+    }
+
+    priority := common.EscalationPriority(service)
+    if priority == 0 || !redmineCheckIssueLog(service) {
+        return
+    }
+
+    current, err := os.ReadFile(priorityStatePath(service))
+    if err == nil && strings.TrimSpace(string(current)) == strconv.Itoa(priority) {
+        return
+    }
+
+    file, err := os.ReadFile(common.TmpDir + "/" + strings.Replace(service, "/", "-", -1) + "-redmine.log")
+    if err != nil {
+        common.LogError("os.ReadFile error: " + err.Error())
+        return
+    }
+
+    issueId, err := strconv.Atoi(strings.TrimSpace(string(file)))
+    if err != nil || issueId <= 0 {
+        return
+    }
+
+    body := RedmineIssue{Issue: Issue{Id: issueId, PriorityId: priority, Notes: "Sorun uzun süredir devam ettiği için öncelik yükseltildi."}}
+
+    jsonBody, err := json.Marshal(body)
+    if err != nil {
+        common.LogError("json.Marshal error: " + err.Error())
+        return
+    }
+
+    url := common.Config.Redmine.Url + "/issues/" + strconv.Itoa(issueId) + ".json"
+
+    if !dryRun("PUT", url, jsonBody) {
+        if !common.RedmineAvailable() {
+            return
+        }
+
+        req, err := http.NewRequest("PUT", url, bytes.NewBuffer(jsonBody))
+        if err != nil {
+            common.LogError("http.NewRequest error: " + err.Error())
+            return
+        }
+
+        req.Header.Set("Content-Type", "application/json")
+        req.Header.Set("X-Redmine-API-Key", common.Config.Redmine.Api_key)
+
+        resp, err := common.RedmineHTTPClient().Do(req)
+        common.Audit("escalate redmine issue #" + strconv.Itoa(issueId) + " to priority " + strconv.Itoa(priority), service, err)
+
+        if err != nil {
+            common.LogError("client.Do error: " + err.Error() + "\n" + "Redmine URL: " + url)
+            common.RedmineFailed(err)
+            return
+        }
+
+        resp.Body.Close()
+    }
+
+    if err := common.AtomicWriteFile(priorityStatePath(service), []byte(strconv.Itoa(priority)), 0644); err != nil {
+        common.LogError("Error writing '" + priorityStatePath(service) + "': " + err.Error())
+    }
+}
@@ -9,6 +9,7 @@ import (
     "os"
     "encoding/json"
     "strings"
+    "github.com/sirupsen/logrus"
     "github.com/monobilisim/monokit/common"
 )
 
@@ -28,6 +29,28 @@ type RedmineIssue struct {
     Issue Issue `json:"issue"`
 }
 
+// dryRunIssueId is written as the issue id when an issue is created in
+// dry-run mode, so the following updates and closes are previewed too
+const dryRunIssueId = "-1"
+
+// dryRun logs the request instead of sending it when redmine.dry_run is set
+// or in collect-only mode, returns whether the request should be skipped.
+func dryRun(method string, url string, body []byte) bool {
+    if !common.Config.Redmine.Dry_Run && !common.CollectOnlyMode {
+        return false
+    }
+
+    message := "Redmine dry-run: " + method + " " + url
+    if len(body) > 0 {
+        message += " " + string(body)
+    }
+
+    common.Println(common.Blue + message + common.Reset)
+    logrus.Info(message)
+
+    return true
+}
+
 func redmineCheckIssueLog(service string) bool {
     serviceReplaced := strings.Replace(service, "/", "-", -1)
     filePath := common.TmpDir + "/" + serviceReplaced + "-redmine.log"
@@ -65,6 +88,9 @@ func redmineCheckIssueLog(service string) bool {
 }
 
 func redmineWrapper(service string, subject string, message string) {
+    if common.QuietFirstRun {
+        return
+    }
     
     if redmineCheckIssueLog(service) == false {
         Create(service, subject, message)
@@ -75,18 +101,39 @@ func redmineWrapper(service string, subject string, message string) {
 
 
 func CheckUp(service string, message string) {
+    if common.StateDegraded {
+        return
+    }
+
     // Remove slashes from service and replace them with -
     serviceReplaced := strings.Replace(service, "/", "-", -1)
-    file_path := common.TmpDir + "/" + serviceReplaced + "-redmine-stat.log"
+    file_path := common.TmpDir + "/" + serviceReplaced + common.RedmineStatSuffix
 
     // Check if the file exists, close issue and remove file if it does
     if _, err := os.Stat(file_path); err == nil {
+        // Keep the file to close the issue once Redmine is back
+        if common.Config.Redmine.Enabled && !common.Config.Redmine.Dry_Run && !common.CollectOnlyMode && !common.RedmineAvailable() {
+            return
+        }
+
+        if common.Config.Redmine.Close_Concurrency > 1 {
+            queueClose(service, message)
+            return
+        }
+
         os.Remove(file_path)
         Close(service, message)
     }
 }
 
 func CheckDown(service string, subject string, message string, EnableCustomIntervals bool, CustomInterval float64) {
+    // The issue can't be tracked without state, it would be created on every run
+    if common.StateDegraded {
+        return
+    }
+
+    escalatePriority(service)
+
     var interval float64
 
 	if EnableCustomIntervals {
@@ -97,7 +144,7 @@ func CheckDown(service string, subject string, message string, EnableCustomInter
 
 	// Remove slashes from service and replace them with -
     serviceReplaced := strings.Replace(service, "/", "-", -1)
-    filePath := common.TmpDir + "/" + serviceReplaced + "-redmine-stat.log"
+    filePath := common.TmpDir + "/" + serviceReplaced + common.RedmineStatSuffix
     currentDate := time.Now().Format("2006-01-02 15:04:05 -0700")
 
     // Check if the file exists
@@ -152,7 +199,7 @@ func CheckDown(service string, subject string, message string, EnableCustomInter
                     common.LogError("Error marshalling JSON: \n" + err.Error())
                 }
 
-                err = os.WriteFile(filePath, jsonData, 0644)
+                err = common.AtomicWriteFile(filePath, jsonData, 0644)
                 
                 redmineWrapper(service, subject, message)
             }
@@ -167,7 +214,7 @@ func CheckDown(service string, subject string, message string, EnableCustomInter
                 common.LogError("Error marshalling JSON: \n" + err.Error())
             }
 
-            err = os.WriteFile(filePath, jsonData, 0644)
+            err = common.AtomicWriteFile(filePath, jsonData, 0644)
 
             if err != nil {
                 common.LogError("Error writing to file: \n" + err.Error())
@@ -185,7 +232,7 @@ func CheckDown(service string, subject string, message string, EnableCustomInter
                         common.LogError("Error marshalling JSON: \n" + err.Error())
                     }
 
-                    err = os.WriteFile(filePath, jsonData, 0644)
+                    err = common.AtomicWriteFile(filePath, jsonData, 0644)
 
                     if err != nil {
                         common.LogError("Error writing to file: \n" + err.Error())
@@ -197,14 +244,6 @@ func CheckDown(service string, subject string, message string, EnableCustomInter
         }
     } else {
 
-        file, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR, 0644)
-        defer file.Close()
-
-        if err != nil {
-            common.LogError("Error opening file for writing: \n" + err.Error())
-            return
-        }
-
         jsonData, err := json.Marshal(&common.ServiceFile{Date: currentDate, Locked: false})
 
         if err != nil {
@@ -212,7 +251,7 @@ func CheckDown(service string, subject string, message string, EnableCustomInter
         }
 
 
-        err = os.WriteFile(filePath, jsonData, 0644)
+        err = common.AtomicWriteFile(filePath, jsonData, 0644)
 
         if err != nil {
             common.LogError("Error writing to file: \n" + err.Error())
@@ -238,7 +277,6 @@ func Create(service string, subject string, message string) {
     }
 
     var priorityId int
-    var projectId string
 
     if common.Config.Redmine.Priority_id == 0 {
         priorityId = 5
@@ -246,10 +284,10 @@ func Create(service string, subject string, message string) {
         priorityId = common.Config.Redmine.Priority_id
     }
 
-    if common.Config.Redmine.Project_id == "" {
-        projectId = strings.Split(common.Config.Identifier, "-")[0]
-    } else {
-        projectId = common.Config.Redmine.Project_id
+    projectId := common.ProjectID()
+
+    if id := common.IncidentID(service); id != "" {
+        message += "\n\nKorelasyon ID: " + id
     }
 
     body := RedmineIssue{Issue: Issue{ProjectId: projectId, TrackerId: 7, Description: message, Subject: subject, PriorityId: priorityId }}
@@ -260,6 +298,18 @@ func Create(service string, subject string, message string) {
         common.LogError("json.Marshal error: " + err.Error())
     }
 
+    if dryRun("POST", common.Config.Redmine.Url + "/issues.json", jsonBody) {
+        err = common.AtomicWriteFile(filePath, []byte(dryRunIssueId), 0644)
+        if err != nil {
+            common.LogError("Error writing '" + filePath + "': " + err.Error())
+        }
+        return
+    }
+
+    if !common.RedmineAvailable() {
+        return
+    }
+
     req, err := http.NewRequest("POST", common.Config.Redmine.Url + "/issues.json", bytes.NewBuffer(jsonBody))
 
     if err != nil {
@@ -269,14 +319,14 @@ func Create(service string, subject string, message string) {
     req.Header.Set("Content-Type", "application/json")
     req.Header.Set("X-Redmine-API-Key", common.Config.Redmine.Api_key)
 
-    client := &http.Client{
-        Timeout: time.Second * 10,
-    }
+    client := common.RedmineHTTPClient()
 
     resp, err := client.Do(req)
 
     if err != nil {
         common.LogError("client.Do error: " + err.Error() + "\n" + "Redmine URL: " + common.Config.Redmine.Url + "/issues.json" + "\n" + "Redmine JSON: " + string(jsonBody))
+        common.RedmineFailed(err)
+        common.Audit("create redmine issue", service, err)
         return
     }
 
@@ -294,11 +344,13 @@ func Create(service string, subject string, message string) {
     // get issue id, convert to string
     issueId := []byte(strconv.Itoa(data.Issue.Id))
 
+    common.Audit("create redmine issue #" + string(issueId), service, nil)
+
     // write issue id to file
-    err = os.WriteFile(filePath, issueId, 0644)
+    err = common.AtomicWriteFile(filePath, issueId, 0644)
 
     if err != nil {
-        common.LogError("os.WriteFile error while trying to read '" + filePath + "'" + err.Error())
+        common.LogError("Error writing '" + filePath + "': " + err.Error())
     }
 }
 
@@ -338,6 +390,14 @@ func ExistsNote(service string, message string) bool {
 
     redmineUrlFinal := common.Config.Redmine.Url + "/issues/" + string(file) + ".json?include=journals"
 
+    if dryRun("GET", redmineUrlFinal, nil) {
+        return false
+    }
+
+    if !common.RedmineAvailable() {
+        return false
+    }
+
     // Send a GET request to the Redmine API to get all issues
     req, err := http.NewRequest("GET", redmineUrlFinal, nil)
 
@@ -349,14 +409,13 @@ func ExistsNote(service string, message string) bool {
     req.Header.Set("Content-Type", "application/json")
     req.Header.Set("X-Redmine-API-Key", common.Config.Redmine.Api_key)
 
-    client := &http.Client{
-        Timeout: time.Second * 10,
-    }
+    client := common.RedmineHTTPClient()
 
     resp, err := client.Do(req)
 
     if err != nil {
         common.LogError("client.Do error: " + err.Error() + "\n" + "Redmine URL: " + redmineUrlFinal)
+        common.RedmineFailed(err)
         return false
     }
 
@@ -381,7 +440,7 @@ func ExistsNote(service string, message string) bool {
 
     // Check if the note already exists
     for _, journal := range data["issue"].(map[string]interface{})["journals"].([]interface{}) {
-        if journal.(map[string]interface{})["notes"].(string) == message {
+        if normalizeNote(journal.(map[string]interface{})["notes"].(string)) == normalizeNote(message) {
             return true
         }
     }
@@ -396,6 +455,14 @@ func Delete(id int) {
         return
     }
 
+    if dryRun("DELETE", common.Config.Redmine.Url + "/issues/" + strconv.Itoa(id) + ".json", nil) {
+        return
+    }
+
+    if !common.RedmineAvailable() {
+        return
+    }
+
     req, err := http.NewRequest("DELETE", common.Config.Redmine.Url + "/issues/" + strconv.Itoa(id) + ".json", nil)
 
     if err != nil {
@@ -405,14 +472,14 @@ func Delete(id int) {
     req.Header.Set("Content-Type", "application/json")
     req.Header.Set("X-Redmine-API-Key", common.Config.Redmine.Api_key)
 
-    client := &http.Client{
-        Timeout: time.Second * 10,
-    }
+    client := common.RedmineHTTPClient()
 
     resp, err := client.Do(req)
+    common.Audit("delete redmine issue #" + strconv.Itoa(id), "", err)
 
     if err != nil {
         common.LogError("client.Do error: " + err.Error() + "\n" + "Redmine URL: " + common.Config.Redmine.Url + "/issues/" + strconv.Itoa(id) + ".json")
+        common.RedmineFailed(err)
         return
     }
 
@@ -427,7 +494,7 @@ func Update(service string, message string, checkNote bool) {
     }
 
     if checkNote {
-        if ExistsNote(service, message) {
+        if !noteAllowed(service, message) || ExistsNote(service, message) {
             return
         }
     }
@@ -471,6 +538,15 @@ func Update(service string, message string, checkNote bool) {
         common.LogError("json.Marshal error: " + err.Error())
     }
 
+    if dryRun("PUT", common.Config.Redmine.Url + "/issues/" + string(file) + ".json", jsonBody) {
+        saveNoteState(service, message)
+        return
+    }
+
+    if !common.RedmineAvailable() {
+        return
+    }
+
     req, err := http.NewRequest("PUT", common.Config.Redmine.Url + "/issues/" + string(file) + ".json", bytes.NewBuffer(jsonBody))
 
     if err != nil {
@@ -480,18 +556,19 @@ func Update(service string, message string, checkNote bool) {
     req.Header.Set("Content-Type", "application/json")
     req.Header.Set("X-Redmine-API-Key", common.Config.Redmine.Api_key)
 
-    client := &http.Client{
-        Timeout: time.Second * 10,
-    }
+    client := common.RedmineHTTPClient()
 
     resp, err := client.Do(req)
 
     if err != nil {
         common.LogError("client.Do error: " + err.Error() + "\n" + "Redmine URL: " + common.Config.Redmine.Url + "/issues/" + string(file) + ".json" + "\n" + "Redmine JSON: " + string(jsonBody))
+        common.RedmineFailed(err)
         return
     }
 
     defer resp.Body.Close()
+
+    saveNoteState(service, message)
 }
 
 
@@ -500,6 +577,14 @@ func getAssignedToId(id string) string {
     // Make request to Redmine API to get the assigned_to_id
     redmineUrlFinal := common.Config.Redmine.Url + "/issues/" + id + ".json"
 
+    if dryRun("GET", redmineUrlFinal, nil) {
+        return ""
+    }
+
+    if !common.RedmineAvailable() {
+        return ""
+    }
+
     req, err := http.NewRequest("GET", redmineUrlFinal, nil)
    
     if err != nil {
@@ -509,14 +594,13 @@ func getAssignedToId(id string) string {
     req.Header.Set("Content-Type", "application/json")
     req.Header.Set("X-Redmine-API-Key", common.Config.Redmine.Api_key)
 
-    client := &http.Client{
-        Timeout: time.Second * 10,
-    }
+    client := common.RedmineHTTPClient()
 
     resp, err := client.Do(req)
 
     if err != nil {
         common.LogError("client.Do error: " + err.Error() + "\n" + "Redmine URL: " + redmineUrlFinal)
+        common.RedmineFailed(err)
         return ""
     }
 
@@ -551,6 +635,14 @@ func getAssignedToId(id string) string {
 }
 
 
+// endIncident forgets the correlation ID once the issue is closed, unless
+// the alarm of the service is still down and uses it
+func endIncident(service string) {
+    if !common.FileExists(common.TmpDir + "/" + strings.Replace(service, "/", "-", -1) + ".log") {
+        common.EndIncident(service)
+    }
+}
+
 func Close(service string, message string) {
     if common.Config.Redmine.Enabled == false {
         return
@@ -604,6 +696,21 @@ func Close(service string, message string) {
     }
 
 
+    if dryRun("PUT", common.Config.Redmine.Url + "/issues/" + string(file) + ".json", jsonBody) {
+        os.Remove(noteStatePath(service))
+        os.Remove(priorityStatePath(service))
+        endIncident(service)
+        err = os.Remove(filePath)
+        if err != nil {
+            common.LogError("os.Remove error: " + err.Error())
+        }
+        return
+    }
+
+    if !common.RedmineAvailable() {
+        return
+    }
+
     req, err := http.NewRequest("PUT", common.Config.Redmine.Url + "/issues/" + string(file) + ".json", bytes.NewBuffer(jsonBody))
 
     if err != nil {
@@ -613,19 +720,23 @@ func Close(service string, message string) {
     req.Header.Set("Content-Type", "application/json")
     req.Header.Set("X-Redmine-API-Key", common.Config.Redmine.Api_key)
 
-    client := &http.Client{
-        Timeout: time.Second * 10,
-    }
+    client := common.RedmineHTTPClient()
 
     resp, err := client.Do(req)
+    common.Audit("close redmine issue #" + string(file), service, err)
 
     if err != nil {
         common.LogError("client.Do error: " + err.Error() + "\n" + "Redmine URL: " + common.Config.Redmine.Url + "/issues/" + string(file) + ".json" + "\n" + "Redmine JSON: " + string(jsonBody))
+        common.RedmineFailed(err)
         return
     }
 
     defer resp.Body.Close()
 
+    os.Remove(noteStatePath(service))
+    os.Remove(priorityStatePath(service))
+    endIncident(service)
+
     // remove file
     err = os.Remove(filePath)
 
@@ -657,13 +768,7 @@ func Show(service string) string {
 }
 
 func Exists(subject string, date string, search bool) string {
-    var projectId string
-
-    if common.Config.Redmine.Project_id == "" {
-        projectId = strings.Split(common.Config.Identifier, "-")[0]
-    } else {
-        projectId = common.Config.Redmine.Project_id
-    }
+    projectId := common.ProjectID()
 
     if common.Config.Redmine.Enabled == false {
         return ""
@@ -683,6 +788,14 @@ func Exists(subject string, date string, search bool) string {
         redmineUrlFinal += "&created_on=" + date
     }
 
+    if dryRun("GET", redmineUrlFinal, nil) {
+        return ""
+    }
+
+    if !common.RedmineAvailable() {
+        return ""
+    }
+
     // Send a GET request to the Redmine API to get all issues
     req, err := http.NewRequest("GET", redmineUrlFinal, nil)
 
@@ -694,14 +807,13 @@ func Exists(subject string, date string, search bool) string {
     req.Header.Set("Content-Type", "application/json")
     req.Header.Set("X-Redmine-API-Key", common.Config.Redmine.Api_key)
 
-    client := &http.Client{
-        Timeout: time.Second * 10,
-    }
+    client := common.RedmineHTTPClient()
 
     resp, err := client.Do(req)
 
     if err != nil {
         common.LogError("client.Do error: " + err.Error() + "\n" + "Redmine URL: " + redmineUrlFinal)
+        common.RedmineFailed(err)
         return ""
     }
 
@@ -0,0 +1,67 @@
+package common
+
+import (
+    "os"
+    "time"
+    "regexp"
+    "strings"
+    "encoding/json"
+    "github.com/monobilisim/monokit/common"
+)
+
+type noteState struct {
+    Date string
+    Note string
+}
+
+// Dates and times that change between otherwise identical notes
+var volatileNoteRe = regexp.MustCompile(`\d{4}-\d{2}-\d{2}([ T]\d{2}:\d{2}(:\d{2}(\.\d+)?)?( ?([+-]\d{2}:?\d{2}|Z))?)?|\b\d{2}:\d{2}(:\d{2})?\b`)
+
+// normalizeNote strips the timestamps from message, so notes only differing
+// by them are treated as duplicates
+func normalizeNote(message string) string {
+    message = volatileNoteRe.ReplaceAllString(message, "")
+    return strings.Join(strings.Fields(message), " ")
+}
+
+func noteStatePath(service string) string {
+    return common.TmpDir + "/" + strings.Replace(service, "/", "-", -1) + "-redmine-note.log"
+}
+
+// noteAllowed reports whether a note can be added to the issue of service,
+// it is not if the previous note was the same after normalization or was
+// added less than redmine.note_interval minutes ago.
+func noteAllowed(service string, message string) bool {
+    file, err := os.ReadFile(noteStatePath(service))
+    if err != nil {
+        return true
+    }
+
+    var state noteState
+    if err := json.Unmarshal(file, &state); err != nil {
+        return true
+    }
+
+    if state.Note == normalizeNote(message) {
+        return false
+    }
+
+    date, err := time.Parse("2006-01-02 15:04:05 -0700", state.Date)
+    if err != nil {
+        return true
+    }
+
+    return time.Since(date).Minutes() >= common.Config.Redmine.Note_Interval
+}
+
+func saveNoteState(service string, message string) {
+    jsonData, err := json.Marshal(noteState{Date: time.Now().Format("2006-01-02 15:04:05 -0700"), Note: normalizeNote(message)})
+    if err != nil {
+        common.LogError("Error marshalling JSON: \n" + err.Error())
+        return
+    }
+
+    if err := common.AtomicWriteFile(noteStatePath(service), jsonData, 0644); err != nil {
+        common.LogError("Error writing to file: \n" + err.Error())
+    }
+}
@@ -3,9 +3,7 @@ package common
 import (
     "bytes"
     "net/http"
-    "time"
     "encoding/json"
-    "strings"
     "github.com/monobilisim/monokit/common"
     "io/ioutil"
     "fmt"
@@ -21,7 +19,7 @@ type RedmineNews struct {
 }
 
 func Create(title string, description string, noDuplicate bool) string {
-    if common.Config.Redmine.Enabled == false {
+    if common.Config.Redmine.Enabled == false || !common.RedmineAvailable() {
         return ""
     }
 
@@ -32,13 +30,7 @@ func Create(title string, description string, noDuplicate bool) string {
         }
     }
    
-    var projectId string
-
-    if common.Config.Redmine.Project_id == "" {
-        projectId = strings.Split(common.Config.Identifier, "-")[0]
-    } else {
-        projectId = common.Config.Redmine.Project_id
-    }
+    projectId := common.ProjectID()
 
     body := RedmineNews{News: News{Title: title, Description: description}} 
 
@@ -57,14 +49,13 @@ func Create(title string, description string, noDuplicate bool) string {
     req.Header.Set("Content-Type", "application/json")
     req.Header.Set("X-Redmine-API-Key", common.Config.Redmine.Api_key)
 
-    client := &http.Client{
-        Timeout: time.Second * 10,
-    }
+    client := common.RedmineHTTPClient()
 
     resp, err := client.Do(req)
 
     if err != nil {
         common.LogError("client.Do error: " + err.Error() + "\n" + "Redmine URL: " + common.Config.Redmine.Url + "/issues.json" + "\n" + "Redmine JSON: " + string(jsonBody))
+        common.RedmineFailed(err)
         return ""
     }
 
@@ -83,7 +74,7 @@ func Create(title string, description string, noDuplicate bool) string {
 }
 
 func Delete(id string) {
-    if common.Config.Redmine.Enabled == false {
+    if common.Config.Redmine.Enabled == false || !common.RedmineAvailable() {
         return
     }
 
@@ -96,14 +87,13 @@ func Delete(id string) {
     req.Header.Set("Content-Type", "application/json")
     req.Header.Set("X-Redmine-API-Key", common.Config.Redmine.Api_key)
 
-    client := &http.Client{
-        Timeout: time.Second * 10,
-    }
+    client := common.RedmineHTTPClient()
 
     resp, err := client.Do(req)
 
     if err != nil {
         common.LogError("client.Do error: " + err.Error() + "\n" + "Redmine URL: " + common.Config.Redmine.Url + "/issues.json")
+        common.RedmineFailed(err)
         return
     }
 
@@ -113,17 +103,11 @@ func Delete(id string) {
 func Exists(title string, description string) string {
     // Check if the news already exist with the same title and description, return id if exists
 
-    if common.Config.Redmine.Enabled == false {
+    if common.Config.Redmine.Enabled == false || !common.RedmineAvailable() {
         return ""
     }
 
-    var projectId string
-
-    if common.Config.Redmine.Project_id == "" {
-        projectId = strings.Split(common.Config.Identifier, "-")[0]
-    } else {
-        projectId = common.Config.Redmine.Project_id
-    }
+    projectId := common.ProjectID()
 
     req, err := http.NewRequest("GET", common.Config.Redmine.Url + "/projects/" + projectId + "/news.json", nil)
 
@@ -134,14 +118,13 @@ func Exists(title string, description string) string {
     req.Header.Set("Content-Type", "application/json")
     req.Header.Set("X-Redmine-API-Key", common.Config.Redmine.Api_key)
 
-    client := &http.Client{
-        Timeout: time.Second * 10,
-    }
+    client := common.RedmineHTTPClient()
 
     resp, err := client.Do(req)
 
     if err != nil {
         common.LogError("client.Do error: " + err.Error() + "\n" + "Redmine URL: " + common.Config.Redmine.Url + "/issues.json")
+        common.RedmineFailed(err)
         return ""
     }
 
@@ -0,0 +1,119 @@
+package common
+
+import (
+    "sync"
+    "time"
+)
+
+// redmineReachabilityVersion is the schema version of the reachability state
+const redmineReachabilityVersion = 1
+
+// redmineProbeTimeout is the timeout of the reachability check, shorter
+// than the one of the requests so an outage doesn't slow down the run
+const redmineProbeTimeout = 3 * time.Second
+
+type redmineReachability struct {
+    Reachable bool `json:"reachable"`
+    Checked string `json:"checked"`
+    Error string `json:"error,omitempty"`
+}
+
+var redmineMu sync.Mutex
+var redmineChecked bool
+var redmineReachable bool
+
+// redmineReachabilityPath is shared by the components, so an outage is
+// alarmed once rather than by each of them
+func redmineReachabilityPath() string {
+    return TmpBaseDir + "redmine-reachability.json"
+}
+
+// resetRedmineCheck forgets the result of the previous run, Init calls it
+// so the daemon checks again for each component instead of keeping the
+// first result for its whole life
+func resetRedmineCheck() {
+    redmineMu.Lock()
+    defer redmineMu.Unlock()
+
+    redmineChecked = false
+    redmineReachable = false
+}
+
+// RedmineAvailable reports whether the Redmine requests should be sent. It
+// checks once per run whether Redmine answers, or trusts the previous
+// result for redmine.unreachable_retry_minutes while Redmine is down, so
+// the issue operations are skipped quickly during an outage.
+func RedmineAvailable() bool {
+    redmineMu.Lock()
+    defer redmineMu.Unlock()
+
+    if redmineChecked {
+        return redmineReachable
+    }
+
+    redmineChecked = true
+
+    retryMinutes := Config.Redmine.Unreachable_Retry_Minutes
+    if retryMinutes == 0 {
+        retryMinutes = 5
+    }
+
+    var previous redmineReachability
+    loaded := LoadCache(redmineReachabilityPath(), redmineReachabilityVersion, &previous)
+
+    if loaded && !previous.Reachable {
+        checked, err := time.Parse(time.RFC3339, previous.Checked)
+        if err == nil && time.Since(checked).Minutes() < retryMinutes {
+            redmineReachable = false
+            return false
+        }
+    }
+
+    client := RedmineHTTPClient()
+    client.Timeout = redmineProbeTimeout
+
+    resp, err := client.Get(Config.Redmine.Url)
+    if err == nil {
+        resp.Body.Close()
+    }
+
+    setRedmineReachable(err, !loaded || previous.Reachable)
+
+    return redmineReachable
+}
+
+// RedmineFailed trips the breaker after a Redmine request couldn't be
+// sent, the remaining requests of the run are skipped
+func RedmineFailed(err error) {
+    redmineMu.Lock()
+    defer redmineMu.Unlock()
+
+    wasReachable := !redmineChecked || redmineReachable
+    redmineChecked = true
+
+    setRedmineReachable(err, wasReachable)
+}
+
+// setRedmineReachable records the result of a check and alarms when the
+// reachability changed, redmineMu has to be held
+func setRedmineReachable(err error, wasReachable bool) {
+    redmineReachable = err == nil
+
+    state := redmineReachability{Reachable: redmineReachable, Checked: time.Now().Format(time.RFC3339)}
+    if err != nil {
+        state.Error = err.Error()
+    }
+
+    if saveErr := SaveCache(redmineReachabilityPath(), redmineReachabilityVersion, state); saveErr != nil {
+        LogError("Error writing the Redmine reachability: " + saveErr.Error())
+    }
+
+    stream, topic := alarmRoute("redmine_unreachable")
+
+    if err != nil && wasReachable {
+        LogError("Redmine is unreachable, skipping the issue operations: " + err.Error())
+        Alarm("[" + ScriptName + " - " + Config.Identifier + "] [:red_circle:] Redmine is unreachable, the issues are not updated until it is back: " + err.Error(), stream, topic, false)
+    } else if err == nil && !wasReachable {
+        Alarm("[" + ScriptName + " - " + Config.Identifier + "] [:check:] Redmine is reachable again", stream, topic, false)
+    }
+}
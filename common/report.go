@@ -0,0 +1,212 @@
+package common
+
+import (
+    "os"
+    "fmt"
+    "bytes"
+    "sort"
+    "time"
+    "strings"
+    "encoding/json"
+    "html/template"
+    "github.com/spf13/cobra"
+)
+
+var ReportCmd = &cobra.Command{
+    Use: "report",
+    Short: "Generate a status report of all components",
+    Run: func(cmd *cobra.Command, args []string) {
+        Init()
+        format, _ := cmd.Flags().GetString("format")
+
+        report, err := Report(format)
+        if err != nil {
+            LogError("Error generating the report: " + err.Error())
+            os.Exit(1)
+        }
+
+        fmt.Print(report)
+    },
+}
+
+type ReportService struct {
+    Name string
+    Since string
+    Alarmed bool
+    IssueUrl string
+}
+
+type ReportComponent struct {
+    Name string
+    Services []ReportService
+}
+
+// downServiceFile decodes the down file of a service written by
+// AlarmCheckDown. The other state files, eg. the flap, pending or Redmine
+// ones, have another shape and are not mistaken for a down service. The
+// down state of issues has the same shape and is recognized by its
+// RedmineStatSuffix.
+func downServiceFile(name string, data []byte) (ServiceFile, bool) {
+    var j ServiceFile
+
+    if strings.HasSuffix(name, RedmineStatSuffix) {
+        return j, false
+    }
+
+    decoder := json.NewDecoder(bytes.NewReader(data))
+    decoder.DisallowUnknownFields()
+    if err := decoder.Decode(&j); err != nil {
+        return j, false
+    }
+
+    if _, err := time.Parse("2006-01-02 15:04:05 -0700", j.Date); err != nil {
+        return j, false
+    }
+
+    return j, true
+}
+
+// collectReport builds the report from the alarm and Redmine state files
+// the components leave in their tmp directories.
+func collectReport(baseDir string) ([]ReportComponent, error) {
+    entries, err := os.ReadDir(baseDir)
+    if err != nil {
+        return nil, err
+    }
+
+    var components []ReportComponent
+
+    for _, entry := range entries {
+        if !entry.IsDir() {
+            continue
+        }
+
+        dir := baseDir + "/" + entry.Name()
+        files, err := os.ReadDir(dir)
+        if err != nil {
+            LogError("Error reading " + dir + ": " + err.Error())
+            continue
+        }
+
+        component := ReportComponent{Name: entry.Name()}
+
+        for _, file := range files {
+            name := file.Name()
+
+            if file.IsDir() || !strings.HasSuffix(name, ".log") {
+                continue
+            }
+
+            fileRead, err := os.ReadFile(dir + "/" + name)
+            if err != nil {
+                continue
+            }
+
+            j, ok := downServiceFile(name, fileRead)
+            if !ok {
+                continue
+            }
+
+            service := strings.TrimSuffix(name, ".log")
+            reportService := ReportService{Name: service, Since: j.Date, Alarmed: j.Locked}
+
+            issueId, err := os.ReadFile(dir + "/" + service + "-redmine.log")
+            if err == nil && strings.TrimSpace(string(issueId)) != "" && strings.TrimSpace(string(issueId)) != "0" {
+                reportService.IssueUrl = Config.Redmine.Url + "/issues/" + strings.TrimSpace(string(issueId))
+            }
+
+            component.Services = append(component.Services, reportService)
+        }
+
+        sort.Slice(component.Services, func(i, k int) bool {
+            return component.Services[i].Name < component.Services[k].Name
+        })
+
+        components = append(components, component)
+    }
+
+    return components, nil
+}
+
+const reportHtmlTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Monokit report - {{.Identifier}}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 4px 8px; }
+.ok { color: green; }
+.down { color: red; }
+</style>
+</head>
+<body>
+<h1>Monokit report - {{.Identifier}}</h1>
+<p>Generated at {{.Date}}</p>
+{{range .Components}}
+<h2>{{.Name}}</h2>
+{{if .Services}}
+<table>
+<tr><th>Service</th><th>Down since</th><th>Alarmed</th><th>Redmine issue</th></tr>
+{{range .Services}}<tr class="down"><td>{{.Name}}</td><td>{{.Since}}</td><td>{{if .Alarmed}}yes{{else}}no{{end}}</td><td>{{if .IssueUrl}}<a href="{{.IssueUrl}}">{{.IssueUrl}}</a>{{end}}</td></tr>
+{{end}}</table>
+{{else}}
+<p class="ok">All services are up</p>
+{{end}}
+{{end}}
+</body>
+</html>
+`
+
+func Report(format string) (string, error) {
+    components, err := collectReport(strings.TrimSuffix(TmpDir, "/"))
+    if err != nil {
+        return "", err
+    }
+
+    date := FormatTime(time.Now())
+
+    switch format {
+    case "html":
+        tmpl, err := template.New("report").Parse(reportHtmlTemplate)
+        if err != nil {
+            return "", err
+        }
+
+        output := &strings.Builder{}
+        err = tmpl.Execute(output, map[string]interface{}{
+            "Identifier": Config.Identifier,
+            "Date": date,
+            "Components": components,
+        })
+
+        return output.String(), err
+    case "md":
+        output := &strings.Builder{}
+        output.WriteString("# Monokit report - " + Config.Identifier + "\n\nGenerated at " + date + "\n")
+
+        for _, component := range components {
+            output.WriteString("\n## " + component.Name + "\n\n")
+
+            if len(component.Services) == 0 {
+                output.WriteString("All services are up\n")
+                continue
+            }
+
+            output.WriteString("| Service | Down since | Alarmed | Redmine issue |\n|---|---|---|---|\n")
+
+            for _, service := range component.Services {
+                alarmed := "no"
+                if service.Alarmed {
+                    alarmed = "yes"
+                }
+                output.WriteString("| " + service.Name + " | " + service.Since + " | " + alarmed + " | " + service.IssueUrl + " |\n")
+            }
+        }
+
+        return output.String(), nil
+    }
+
+    return "", fmt.Errorf("unknown format '%s', expected html or md", format)
+}
@@ -0,0 +1,138 @@
+package common
+
+import (
+    "bytes"
+    "errors"
+    "context"
+    "os/exec"
+    "strconv"
+    "strings"
+    "github.com/sirupsen/logrus"
+)
+
+// CommandRunner runs an external command and returns its stdout and stderr.
+type CommandRunner interface {
+    Run(ctx context.Context, name string, args ...string) (string, string, error)
+}
+
+// defaultMaxCommandOutputKb bounds the captured output of a command when
+// max_command_output_kb is not set
+const defaultMaxCommandOutputKb = 10 * 1024
+
+// limitedBuffer keeps the first limit bytes written to it and discards
+// the rest, so a runaway command can't use up the memory
+type limitedBuffer struct {
+    buffer bytes.Buffer
+    limit int
+    truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+    if remaining := b.limit - b.buffer.Len(); remaining < len(p) {
+        b.truncated = true
+        if remaining > 0 {
+            b.buffer.Write(p[:remaining])
+        }
+        return len(p), nil
+    }
+
+    return b.buffer.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+    return b.buffer.String()
+}
+
+// OutputTruncatedError is returned by ExecRunner when the output of the
+// command was cut at max_command_output_kb. The partial output is returned
+// along with it, but anything counted from it is not the real number. Err
+// is the error of the command itself, if it failed.
+type OutputTruncatedError struct {
+    Command string
+    Limit int
+    Err error
+}
+
+func (e *OutputTruncatedError) Error() string {
+    msg := "the output of '" + e.Command + "' was truncated at " + strconv.Itoa(e.Limit) + " bytes"
+    if e.Err != nil {
+        msg += ": " + e.Err.Error()
+    }
+    return msg
+}
+
+func (e *OutputTruncatedError) Unwrap() error {
+    return e.Err
+}
+
+// OutputTruncated reports whether err says the output of the command was
+// truncated
+func OutputTruncated(err error) bool {
+    var truncErr *OutputTruncatedError
+    return errors.As(err, &truncErr)
+}
+
+func maxCommandOutput() int {
+    if Config.Max_Command_Output_Kb > 0 {
+        return Config.Max_Command_Output_Kb * 1024
+    }
+    return defaultMaxCommandOutputKb * 1024
+}
+
+// ExecRunner runs commands through os/exec, the captured output is
+// truncated at max_command_output_kb and an OutputTruncatedError returned.
+type ExecRunner struct{}
+
+func (ExecRunner) Run(ctx context.Context, name string, args ...string) (string, string, error) {
+    stdout := limitedBuffer{limit: maxCommandOutput()}
+    stderr := limitedBuffer{limit: maxCommandOutput()}
+
+    cmd := exec.CommandContext(ctx, name, args...)
+    cmd.Stdout = &stdout
+    cmd.Stderr = &stderr
+
+    err := cmd.Run()
+
+    if err != nil {
+        logrus.Debug("Ran '" + cmd.String() + "': " + err.Error())
+    } else {
+        logrus.Debug("Ran '" + cmd.String() + "'")
+    }
+
+    if stdout.truncated || stderr.truncated {
+        logrus.Warn("The output of '" + cmd.String() + "' was truncated at " + strconv.Itoa(stdout.limit) + " bytes")
+        err = &OutputTruncatedError{Command: cmd.String(), Limit: stdout.limit, Err: err}
+    }
+
+    return stdout.String(), stderr.String(), err
+}
+
+// FakeResult is the canned output of a single FakeRunner command.
+type FakeResult struct {
+    Stdout string
+    Stderr string
+    Err error
+}
+
+// FakeRunner returns canned results keyed by the full command line
+// ("name arg1 arg2"), and records every command it was asked to run.
+type FakeRunner struct {
+    Results map[string]FakeResult
+    Calls []string
+}
+
+func (f *FakeRunner) Run(ctx context.Context, name string, args ...string) (string, string, error) {
+    command := strings.TrimSpace(name + " " + strings.Join(args, " "))
+    f.Calls = append(f.Calls, command)
+
+    result, ok := f.Results[command]
+    if !ok {
+        return "", "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+    }
+
+    return result.Stdout, result.Stderr, result.Err
+}
+
+// Runner is used by the health checks to run external commands, it can be
+// replaced with a FakeRunner to test the parsing and alarm logic.
+var Runner CommandRunner = ExecRunner{}
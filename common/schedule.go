@@ -0,0 +1,70 @@
+package common
+
+import (
+    "os"
+    "time"
+    "strings"
+)
+
+func scheduleFilePath(name string) string {
+    return TmpDir + "/" + strings.Replace(name, "/", "-", -1) + "-lastrun.log"
+}
+
+// ScheduleDue reports whether the daily task name, scheduled at the HH:MM
+// time at, hasn't run since its latest slot. A slot missed because of a
+// delayed or skipped run is caught on the next run. The first time a task
+// is seen it is only scheduled from the next slot on. ScheduleDone has to be
+// called once the task has run.
+func ScheduleDue(name string, at string) bool {
+    return ScheduleDueWithin(name, at, 0)
+}
+
+// ScheduleDueWithin is ScheduleDue for the disruptive tasks, a missed slot
+// is only caught up within window of it. A later run skips the slot, it is
+// recorded as done and the task waits for the next one. A window of 0
+// catches up at any time.
+func ScheduleDueWithin(name string, at string, window time.Duration) bool {
+    slotTime, err := time.Parse("15:04", at)
+    if err != nil {
+        LogError("Invalid schedule '" + at + "' for " + name + ", expected HH:MM")
+        return false
+    }
+
+    now := time.Now()
+    slot := time.Date(now.Year(), now.Month(), now.Day(), slotTime.Hour(), slotTime.Minute(), 0, 0, now.Location())
+    if slot.After(now) {
+        slot = slot.AddDate(0, 0, -1)
+    }
+
+    file, err := os.ReadFile(scheduleFilePath(name))
+    if err != nil {
+        ScheduleDone(name)
+        return false
+    }
+
+    lastRun, err := time.Parse(time.RFC3339, strings.TrimSpace(string(file)))
+    if err != nil {
+        ScheduleDone(name)
+        return false
+    }
+
+    if !lastRun.Before(slot) {
+        return false
+    }
+
+    if window > 0 && now.Sub(slot) > window {
+        LogError("Skipping the " + name + " slot at " + FormatTime(slot) + ", it was missed by more than " + HumanizeDuration(window) + ", waiting for the next one")
+        ScheduleDone(name)
+        return false
+    }
+
+    return true
+}
+
+// ScheduleDone records that the task name has run
+func ScheduleDone(name string) {
+    err := AtomicWriteFile(scheduleFilePath(name), []byte(time.Now().Format(time.RFC3339)), 0644)
+    if err != nil {
+        LogError("Error writing the last run of " + name + ": \n" + err.Error())
+    }
+}
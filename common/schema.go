@@ -0,0 +1,147 @@
+package common
+
+import (
+    "reflect"
+    "strconv"
+    "strings"
+)
+
+// ConfigSchema returns a commented example YAML of config, with the type of
+// every key. The key is the lowercased field name unless a mapstructure tag
+// names it, a doc tag is added to the comment and a default tag is used as
+// the example value. Most defaults are applied in code, the keys without a
+// default tag are shown with their zero value.
+func ConfigSchema(config interface{}) string {
+    if config == nil {
+        return ""
+    }
+
+    output := &strings.Builder{}
+    writeSchema(output, reflect.TypeOf(config), 0)
+
+    return output.String()
+}
+
+func schemaType(t reflect.Type) reflect.Type {
+    for t.Kind() == reflect.Pointer {
+        t = t.Elem()
+    }
+    return t
+}
+
+// schemaNested reports whether t is written as a nested block rather than
+// an inline value
+func schemaNested(t reflect.Type) bool {
+    t = schemaType(t)
+
+    if t.Kind() == reflect.Struct && t.PkgPath() != "time" {
+        return true
+    }
+
+    if t.Kind() == reflect.Slice {
+        elem := schemaType(t.Elem())
+        return elem.Kind() == reflect.Struct && elem.PkgPath() != "time"
+    }
+
+    return false
+}
+
+// schemaValue returns the example value of a key of type t
+func schemaValue(t reflect.Type, def string) string {
+    t = schemaType(t)
+
+    if def != "" {
+        if t.Kind() == reflect.String {
+            return strconv.Quote(def)
+        }
+        return def
+    }
+
+    switch t.Kind() {
+    case reflect.Bool:
+        return "false"
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+        reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+        reflect.Float32, reflect.Float64:
+        return "0"
+    case reflect.Slice, reflect.Array:
+        return "[]"
+    case reflect.Map:
+        return "{}"
+    case reflect.String, reflect.Struct:
+        return "\"\""
+    }
+
+    return "null"
+}
+
+func writeSchema(output *strings.Builder, t reflect.Type, depth int) {
+    t = schemaType(t)
+    if t.Kind() != reflect.Struct {
+        return
+    }
+
+    indent := strings.Repeat("  ", depth)
+
+    for i := 0; i < t.NumField(); i++ {
+        field := t.Field(i)
+        if !field.IsExported() {
+            continue
+        }
+
+        key := strings.ToLower(field.Name)
+        if name := strings.Split(field.Tag.Get("mapstructure"), ",")[0]; name != "" {
+            if name == "-" {
+                continue
+            }
+            key = name
+        }
+
+        def := field.Tag.Get("default")
+        doc := field.Tag.Get("doc")
+
+        if !schemaNested(field.Type) {
+            comment := field.Type.String()
+            if def != "" {
+                comment += ", default " + def
+            }
+            if doc != "" {
+                comment += " - " + doc
+            }
+
+            output.WriteString(indent + "# " + comment + "\n")
+            output.WriteString(indent + key + ": " + schemaValue(field.Type, def) + "\n")
+            continue
+        }
+
+        // The type of a block is spelled out by its keys
+        if depth == 0 && output.Len() > 0 {
+            output.WriteString("\n")
+        }
+        if doc != "" {
+            output.WriteString(indent + "# " + doc + "\n")
+        }
+        output.WriteString(indent + key + ":\n")
+
+        fieldType := schemaType(field.Type)
+        if fieldType.Kind() == reflect.Struct {
+            writeSchema(output, fieldType, depth + 1)
+            continue
+        }
+
+        // A list of structs, one example item is shown
+        item := &strings.Builder{}
+        writeSchema(item, fieldType.Elem(), 0)
+
+        itemIndent := indent + "  "
+        first := true
+        for _, line := range strings.Split(strings.TrimSuffix(item.String(), "\n"), "\n") {
+            if first && !strings.HasPrefix(line, "#") {
+                output.WriteString(itemIndent + "- " + line + "\n")
+                first = false
+                continue
+            }
+            output.WriteString(itemIndent + "  " + line + "\n")
+        }
+    }
+}
@@ -0,0 +1,125 @@
+package common
+
+import (
+    "time"
+    "strings"
+)
+
+// seriesVersion is the schema version of the stored samples
+const seriesVersion = 1
+
+type Sample struct {
+    Time time.Time
+    Value float64
+}
+
+// Series stores numeric samples of a value over time under Name in the
+// component tmp directory, keeping at most MaxSamples of them and, if
+// MaxAge is set, none older than it.
+type Series struct {
+    Name string
+    MaxSamples int
+    MaxAge time.Duration
+}
+
+func NewSeries(name string) Series {
+    return Series{Name: name, MaxSamples: 1000}
+}
+
+func (s Series) filePath() string {
+    return TmpDir + "/" + strings.Replace(s.Name, "/", "-", -1) + "-series.json"
+}
+
+// Samples returns all the stored samples, oldest first
+func (s Series) Samples() []Sample {
+    var samples []Sample
+    LoadCache(s.filePath(), seriesVersion, &samples)
+    return samples
+}
+
+// Append stores value with the current time, dropping the oldest samples
+// above MaxSamples or MaxAge
+func (s Series) Append(value float64) error {
+    samples := append(s.Samples(), Sample{Time: time.Now(), Value: value})
+
+    if s.MaxAge > 0 {
+        samples = s.since(samples, time.Now().Add(-s.MaxAge))
+    }
+
+    if s.MaxSamples > 0 && len(samples) > s.MaxSamples {
+        samples = samples[len(samples)-s.MaxSamples:]
+    }
+
+    return SaveCache(s.filePath(), seriesVersion, samples)
+}
+
+// Last returns the last n samples
+func (s Series) Last(n int) []Sample {
+    samples := s.Samples()
+    if len(samples) > n {
+        samples = samples[len(samples)-n:]
+    }
+    return samples
+}
+
+// Since returns the samples taken after t
+func (s Series) Since(t time.Time) []Sample {
+    return s.since(s.Samples(), t)
+}
+
+func (s Series) since(samples []Sample, t time.Time) []Sample {
+    var since []Sample
+    for _, sample := range samples {
+        if sample.Time.After(t) {
+            since = append(since, sample)
+        }
+    }
+    return since
+}
+
+// SamplesSum returns the sum of the values of the samples
+func SamplesSum(samples []Sample) float64 {
+    sum := 0.0
+    for _, sample := range samples {
+        sum += sample.Value
+    }
+    return sum
+}
+
+func SamplesAvg(samples []Sample) float64 {
+    if len(samples) == 0 {
+        return 0
+    }
+
+    return SamplesSum(samples) / float64(len(samples))
+}
+
+func SamplesMax(samples []Sample) float64 {
+    if len(samples) == 0 {
+        return 0
+    }
+
+    max := samples[0].Value
+    for _, sample := range samples[1:] {
+        if sample.Value > max {
+            max = sample.Value
+        }
+    }
+
+    return max
+}
+
+// SamplesEwma returns the exponentially weighted moving average of the
+// samples, alpha (0-1] is the weight of the newer sample at each step.
+func SamplesEwma(samples []Sample, alpha float64) float64 {
+    if len(samples) == 0 {
+        return 0
+    }
+
+    ewma := samples[0].Value
+    for _, sample := range samples[1:] {
+        ewma = alpha * sample.Value + (1 - alpha) * ewma
+    }
+
+    return ewma
+}
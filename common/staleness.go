@@ -0,0 +1,116 @@
+package common
+
+import (
+    "os"
+    "fmt"
+    "time"
+    "strings"
+)
+
+const lastSuccessSuffix = "-lastsuccess.log"
+
+// runIntervalVersion is the schema version of the run interval state
+const runIntervalVersion = 1
+
+type runInterval struct {
+    Last time.Time `json:"last"`
+    Seconds float64 `json:"seconds"`
+}
+
+func runIntervalPath() string {
+    return TmpDir + "/run-interval.json"
+}
+
+// LastRunPath is the file holding the last run of the component name. It is
+// kept under TmpBaseDir rather than TmpDir, so it is found at the same place
+// whatever TmpDir the component was run with.
+func LastRunPath(name string) string {
+    return TmpBaseDir + name + "/.last-run"
+}
+
+// recordRun remembers when the component ran and the interval since its
+// previous run, which is the interval it is expected to run at
+func recordRun() {
+    var interval runInterval
+    LoadCache(runIntervalPath(), runIntervalVersion, &interval)
+
+    now := time.Now()
+    if !interval.Last.IsZero() && now.After(interval.Last) {
+        interval.Seconds = now.Sub(interval.Last).Seconds()
+    }
+    interval.Last = now
+
+    if err := SaveCache(runIntervalPath(), runIntervalVersion, interval); err != nil {
+        LogError("Error writing the run interval: " + err.Error())
+    }
+
+    if err := AtomicWriteFile(LastRunPath(ScriptName), []byte(now.Format(time.RFC3339)), 0644); err != nil {
+        LogError("Error writing the last run: " + err.Error())
+    }
+}
+
+// CheckSucceeded records that the check name has completed successfully
+func CheckSucceeded(name string) {
+    filePath := TmpDir + "/" + strings.Replace(name, "/", "-", -1) + lastSuccessSuffix
+
+    err := AtomicWriteFile(filePath, []byte(time.Now().Format(time.RFC3339)), 0644)
+    if err != nil {
+        LogError("Error writing the last success of " + name + ": \n" + err.Error())
+    }
+}
+
+// CheckStaleness alarms for the checks of the component that haven't
+// succeeded for alarm.stale_runs times the interval the component runs at,
+// or alarm.stale_minutes if that is longer, so a check failing on every run
+// doesn't go unnoticed behind its old results. It is called after the
+// component has run, when its checks had their chance to succeed.
+func CheckStaleness() {
+    entries, err := os.ReadDir(TmpDir)
+    if err != nil {
+        return
+    }
+
+    staleRuns := Config.Alarm.Stale_Runs
+    if staleRuns == 0 {
+        staleRuns = 3
+    }
+
+    var interval runInterval
+    LoadCache(runIntervalPath(), runIntervalVersion, &interval)
+
+    staleMinutes := staleRuns * interval.Seconds / 60
+    if Config.Alarm.Stale_Minutes > staleMinutes {
+        staleMinutes = Config.Alarm.Stale_Minutes
+    }
+
+    // The interval is not known until the second run
+    if staleMinutes == 0 {
+        return
+    }
+
+    for _, entry := range entries {
+        if entry.IsDir() || !strings.HasSuffix(entry.Name(), lastSuccessSuffix) {
+            continue
+        }
+
+        name := strings.TrimSuffix(entry.Name(), lastSuccessSuffix)
+
+        file, err := os.ReadFile(TmpDir + "/" + entry.Name())
+        if err != nil {
+            continue
+        }
+
+        lastSuccess, err := time.Parse(time.RFC3339, strings.TrimSpace(string(file)))
+        if err != nil {
+            continue
+        }
+
+        since := time.Since(lastSuccess)
+
+        if since.Minutes() > staleMinutes {
+            AlarmCheckDown("stale_" + name, fmt.Sprintf("The %s check hasn't succeeded for %s, last success at %s", name, HumanizeDuration(since), FormatTime(lastSuccess)), false)
+        } else {
+            AlarmCheckUp("stale_" + name, "The " + name + " check is succeeding again", false)
+        }
+    }
+}
@@ -0,0 +1,56 @@
+package common
+
+import (
+    "os"
+    "strings"
+    "time"
+)
+
+// StateDegraded is set when the state directory can't be written, eg. the
+// disk is full. The alarm and Redmine state can't be kept then, so down
+// alarms are sent on every run instead of being suppressed, recoveries are
+// not sent and Redmine issues are left alone.
+var StateDegraded bool
+
+// stateDirAlarmed is set once the state directory alarm was sent by this
+// process, for when the sentinel can't be written either
+var stateDirAlarmed bool
+
+// stateDirSentinel returns the file marking that the state directory alarm
+// was sent. It is kept outside of TmpBaseDir, which is what isn't writable.
+func stateDirSentinel() string {
+    return "/var/tmp/monokit-state-" + strings.ReplaceAll(strings.Trim(TmpDir, "/"), "/", "-")
+}
+
+// checkStateDir probes whether TmpDir is writable and alarms once if it is
+// not, and again when it is writable again
+func checkStateDir() {
+    sentinel := stateDirSentinel()
+    messagePrefix := "[" + ScriptName + " - " + Config.Identifier + "] "
+
+    err := AtomicWriteFile(TmpDir + "/.state-check", []byte(time.Now().Format(time.RFC3339)), 0644)
+    if err == nil {
+        StateDegraded = false
+
+        if stateDirAlarmed || FileExists(sentinel) {
+            Alarm(messagePrefix + "[:check:] State directory " + TmpDir + " is writable again", "", "", false)
+            os.Remove(sentinel)
+            stateDirAlarmed = false
+        }
+        return
+    }
+
+    StateDegraded = true
+    LogError("State directory " + TmpDir + " is not writable, alarms can't be deduplicated: " + err.Error())
+
+    if stateDirAlarmed || FileExists(sentinel) {
+        return
+    }
+
+    Alarm(messagePrefix + "[:red_circle:] State directory " + TmpDir + " is not writable, alarm deduplication and Redmine tracking are unavailable: " + err.Error(), "", "", false)
+    stateDirAlarmed = true
+
+    if writeErr := os.WriteFile(sentinel, []byte(time.Now().Format(time.RFC3339)), 0644); writeErr != nil {
+        LogError("Error writing the state directory sentinel, the alarm will be repeated on every run: " + writeErr.Error())
+    }
+}
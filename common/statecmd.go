@@ -0,0 +1,184 @@
+package common
+
+import (
+    "os"
+    "fmt"
+    "time"
+    "strings"
+    "path/filepath"
+    "encoding/json"
+    "github.com/spf13/cobra"
+    "github.com/sirupsen/logrus"
+)
+
+// stateExportVersion is the format version of the state exports
+const stateExportVersion = 1
+
+type StateExport struct {
+    Version int `json:"version"`
+    Identifier string `json:"identifier"`
+    Exported string `json:"exported"`
+    // Component state directory name to file name to contents
+    Components map[string]map[string]string `json:"components"`
+}
+
+var StateCmd = &cobra.Command{
+    Use: "state",
+    Short: "Export or import the state of the components, eg. to move it to a rebuilt host",
+}
+
+var StateExportCmd = &cobra.Command{
+    Use: "export <file>",
+    Short: "Export the alarm and Redmine state of the components to a JSON file",
+    Args: cobra.ExactArgs(1),
+    Run: func(cmd *cobra.Command, args []string) {
+        Init()
+        components, _ := cmd.Flags().GetStringArray("component")
+
+        export, err := ExportState(components)
+        if err != nil {
+            LogError("Error exporting the state: " + err.Error())
+            os.Exit(1)
+        }
+
+        jsonData, err := json.MarshalIndent(export, "", "  ")
+        if err == nil {
+            err = AtomicWriteFile(args[0], jsonData, 0600)
+        }
+        if err != nil {
+            LogError("Error writing " + args[0] + ": " + err.Error())
+            os.Exit(1)
+        }
+
+        fmt.Println("Exported the state of " + fmt.Sprint(len(export.Components)) + " components to " + args[0])
+    },
+}
+
+var StateImportCmd = &cobra.Command{
+    Use: "import <file>",
+    Short: "Import the state of the components from a JSON file made by state export",
+    Args: cobra.ExactArgs(1),
+    Run: func(cmd *cobra.Command, args []string) {
+        Init()
+        components, _ := cmd.Flags().GetStringArray("component")
+
+        file, err := os.ReadFile(args[0])
+        if err != nil {
+            LogError("Error reading " + args[0] + ": " + err.Error())
+            os.Exit(1)
+        }
+
+        var export StateExport
+        if err := json.Unmarshal(file, &export); err != nil {
+            LogError("Error parsing " + args[0] + ": " + err.Error())
+            os.Exit(1)
+        }
+
+        imported, err := ImportState(export, components)
+        if err != nil {
+            LogError("Error importing the state: " + err.Error())
+            os.Exit(1)
+        }
+
+        fmt.Println("Imported " + fmt.Sprint(imported) + " state files from " + args[0])
+    },
+}
+
+// stateName reports whether name can be used as a state directory or file
+// name, so an import can't write outside of TmpBaseDir
+func stateName(name string) bool {
+    return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// ExportState reads the state files of the given components, or of all the
+// installed ones if none are given
+func ExportState(components []string) (StateExport, error) {
+    export := StateExport{
+        Version: stateExportVersion,
+        Identifier: Config.Identifier,
+        Exported: time.Now().Format(time.RFC3339),
+        Components: make(map[string]map[string]string),
+    }
+
+    if len(components) == 0 {
+        components = InstalledComponents()
+    }
+
+    for _, component := range components {
+        if !stateName(component) {
+            return export, fmt.Errorf("invalid component name '%s'", component)
+        }
+
+        dir := filepath.Join(TmpBaseDir, component)
+        entries, err := os.ReadDir(dir)
+        if err != nil {
+            if os.IsNotExist(err) {
+                continue
+            }
+            return export, err
+        }
+
+        files := make(map[string]string)
+
+        for _, entry := range entries {
+            if !entry.Type().IsRegular() {
+                continue
+            }
+
+            contents, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+            if err != nil {
+                return export, err
+            }
+
+            files[entry.Name()] = string(contents)
+        }
+
+        export.Components[component] = files
+    }
+
+    return export, nil
+}
+
+// ImportState writes the exported state files of the given components, or
+// of all of them if none are given, overwriting the existing ones. It
+// returns the number of files written.
+func ImportState(export StateExport, components []string) (int, error) {
+    if export.Version != stateExportVersion {
+        return 0, fmt.Errorf("unsupported export version %d, expected %d", export.Version, stateExportVersion)
+    }
+
+    if export.Identifier != Config.Identifier {
+        logrus.Warn("Importing the state exported from '" + export.Identifier + "' to '" + Config.Identifier + "'")
+    }
+
+    imported := 0
+
+    for component, files := range export.Components {
+        if len(components) > 0 && !IsInArray(component, components) {
+            continue
+        }
+
+        if !stateName(component) {
+            return imported, fmt.Errorf("invalid component name '%s'", component)
+        }
+
+        dir := filepath.Join(TmpBaseDir, component)
+        if err := os.MkdirAll(dir, 0755); err != nil {
+            return imported, err
+        }
+
+        for name, contents := range files {
+            if !stateName(name) {
+                return imported, fmt.Errorf("invalid file name '%s' in %s", name, component)
+            }
+
+            if err := AtomicWriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+                return imported, err
+            }
+
+            imported++
+        }
+    }
+
+    return imported, nil
+}
@@ -0,0 +1,148 @@
+package common
+
+import (
+    "os"
+    "fmt"
+    "time"
+    "strings"
+    "path/filepath"
+    "github.com/shirou/gopsutil/v4/disk"
+)
+
+// stateStorageVersion is the schema version of the state storage check
+const stateStorageVersion = 1
+
+// stateStorageInterval is how often the state storage is checked, by
+// whichever component runs first after it passed
+const stateStorageInterval = time.Hour
+
+type stateStorageState struct {
+    Checked time.Time `json:"checked"`
+    Full bool `json:"full"`
+}
+
+// stateStoragePath is shared by the components, the state storage is
+// checked once for the host
+func stateStoragePath() string {
+    return TmpBaseDir + "state-storage.json"
+}
+
+// stateSize returns the total size of the files under dir
+func stateSize(dir string) int64 {
+    var size int64
+
+    filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+        if err != nil {
+            return nil
+        }
+
+        if entry.Type().IsRegular() {
+            if info, err := entry.Info(); err == nil {
+                size += info.Size()
+            }
+        }
+
+        return nil
+    })
+
+    return size
+}
+
+// commandStateDirs are the state directories of the commands that aren't
+// components, eg. the logins sshNotifier backfills from. They are kept
+// like the ones of KnownComponents.
+var commandStateDirs = []string{"sshNotifier", "shutdownNotifier", "lbPolicy"}
+
+// pruneState removes the temporary files left behind by an interrupted
+// AtomicWriteFile, the old per component state_storage alarms and, if
+// prune_days is set, the directories of unknown components, eg. removed
+// ones, that haven't been touched for that long. The state of the known
+// components and commands is never removed, an open issue, a down service
+// or the recorded logins would be forgotten.
+func pruneState(pruneDays float64) {
+    filepath.WalkDir(TmpBaseDir, func(path string, entry os.DirEntry, err error) error {
+        if err != nil {
+            return nil
+        }
+
+        info, err := entry.Info()
+        if err != nil {
+            return nil
+        }
+
+        if !entry.IsDir() && strings.HasPrefix(entry.Name(), ".") && strings.Contains(entry.Name(), ".tmp-") && time.Since(info.ModTime()) > 24 * time.Hour {
+            os.Remove(path)
+            return nil
+        }
+
+        // Left by the per component alarm of older versions
+        if !entry.IsDir() && entry.Name() == "state_storage.log" {
+            os.Remove(path)
+            return nil
+        }
+
+        if entry.IsDir() && filepath.Dir(path) == filepath.Clean(TmpBaseDir) && pruneDays > 0 && !IsInArray(entry.Name(), KnownComponents) && !IsInArray(entry.Name(), commandStateDirs) {
+            if time.Since(info.ModTime()).Hours() > pruneDays * 24 {
+                if err := os.RemoveAll(path); err != nil {
+                    LogError("Error pruning " + path + ": " + err.Error())
+                }
+            }
+            return filepath.SkipDir
+        }
+
+        return nil
+    })
+}
+
+// checkStateStorage alarms when the state of monokit grows above
+// state_storage.max_size_mb or the filesystem it is on has less than
+// state_storage.min_free_mb left, monokit can't keep its state once it is
+// full. It runs at most once per stateStorageInterval for the host and
+// alarms when the state changes, rather than once per component.
+func checkStateStorage() {
+    var previous stateStorageState
+    LoadCache(stateStoragePath(), stateStorageVersion, &previous)
+
+    if time.Since(previous.Checked) < stateStorageInterval {
+        return
+    }
+
+    config := Config.State_Storage
+
+    maxSize := config.Max_Size_Mb
+    if maxSize == 0 {
+        maxSize = 100
+    }
+
+    minFree := config.Min_Free_Mb
+    if minFree == 0 {
+        minFree = 50
+    }
+
+    pruneState(config.Prune_Days)
+
+    size := stateSize(TmpBaseDir)
+
+    usage, err := disk.Usage(TmpBaseDir)
+    if err != nil {
+        LogError("Error getting the free space of " + TmpBaseDir + ": " + err.Error())
+        return
+    }
+
+    sizeMb := float64(size) / 1024 / 1024
+    freeMb := float64(usage.Free) / 1024 / 1024
+
+    state := stateStorageState{Checked: time.Now(), Full: sizeMb > maxSize || freeMb < minFree}
+
+    if err := SaveCache(stateStoragePath(), stateStorageVersion, state); err != nil {
+        LogError("Error writing the state storage check: " + err.Error())
+    }
+
+    stream, topic := alarmRoute("state_storage")
+
+    if state.Full && !previous.Full {
+        Alarm(fmt.Sprintf("[monokit - " + Config.Identifier + "] [:red_circle:] The state directory %s is running out of space, it uses %.1f MB with %.1f MB free on %s. Remove the directories of the components that no longer run there or set state_storage.prune_days, and check what else fills %s", TmpBaseDir, sizeMb, freeMb, usage.Path, usage.Path), stream, topic, false)
+    } else if !state.Full && previous.Full {
+        Alarm(fmt.Sprintf("[monokit - " + Config.Identifier + "] [:check:] The state directory %s has enough space again, it uses %.1f MB with %.1f MB free", TmpBaseDir, sizeMb, freeMb), stream, topic, false)
+    }
+}
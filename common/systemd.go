@@ -3,6 +3,7 @@ package common
 
 import (
     "context"
+    "strings"
     "github.com/coreos/go-systemd/v22/dbus"
 )
 
@@ -32,3 +33,63 @@ func SystemdUnitActive(unitName string) bool {
 
     return false
 }
+
+// SystemdUnitExists reports whether the unit is known to systemd, whether
+// it is active or not
+func SystemdUnitExists(unitName string) bool {
+    ctx := context.Background()
+
+    systemdConnection, err := dbus.NewSystemConnectionContext(ctx)
+    if err != nil {
+        LogError("Error connecting to systemd: " + err.Error())
+        return false
+    }
+
+    defer systemdConnection.Close()
+
+    units, err := systemdConnection.ListUnitsByNamesContext(ctx, []string{unitName})
+    if err != nil {
+        LogError("Error listing systemd units: " + err.Error())
+        return false
+    }
+
+    return len(units) > 0 && units[0].LoadState != "not-found"
+}
+
+// SystemdUnitsActive returns whether each loaded unit matching the glob
+// pattern, eg. "carbonio-*.service", is active. Oneshot services that ran
+// and exited, eg. the ones started by a timer, are left out as they are
+// not expected to keep running.
+func SystemdUnitsActive(pattern string) (map[string]bool, error) {
+    ctx := context.Background()
+
+    systemdConnection, err := dbus.NewSystemConnectionContext(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    defer systemdConnection.Close()
+
+    units, err := systemdConnection.ListUnitsByPatternsContext(ctx, []string{}, []string{pattern})
+    if err != nil {
+        return nil, err
+    }
+
+    active := make(map[string]bool)
+    for _, unit := range units {
+        if unit.LoadState == "not-found" {
+            continue
+        }
+
+        if unit.ActiveState == "inactive" && strings.HasSuffix(unit.Name, ".service") {
+            serviceType, err := systemdConnection.GetServicePropertyContext(ctx, unit.Name, "Type")
+            if err == nil && serviceType.Value.Value() == "oneshot" {
+                continue
+            }
+        }
+
+        active[unit.Name] = unit.ActiveState == "active"
+    }
+
+    return active, nil
+}
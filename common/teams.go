@@ -0,0 +1,118 @@
+package common
+
+import (
+    "bytes"
+    "time"
+    "errors"
+    "strings"
+    "html"
+    "encoding/json"
+)
+
+// teamsEmoji translates the emoji shorthand of the alarms, Teams doesn't
+// know them
+var teamsEmoji = map[string]string{
+    ":red_circle:": "🔴",
+    ":check:": "✅",
+    ":warning:": "⚠️",
+    ":info:": "ℹ️",
+    ":green:": "🟢",
+}
+
+type teamsSection struct {
+    ActivityTitle string `json:"activityTitle,omitempty"`
+    Text string `json:"text"`
+}
+
+type teamsCard struct {
+    Type string `json:"@type"`
+    Context string `json:"@context"`
+    Summary string `json:"summary"`
+    ThemeColor string `json:"themeColor"`
+    Title string `json:"title"`
+    Sections []teamsSection `json:"sections,omitempty"`
+}
+
+// newTeamsCard converts an alarm to a MessageCard, the first line is the
+// title and every code or spoiler block becomes its own section
+func newTeamsCard(m string) teamsCard {
+    themeColor := "0076D7"
+    switch {
+    case strings.Contains(m, ":red_circle:"):
+        themeColor = "D70000"
+    case strings.Contains(m, ":warning:"):
+        themeColor = "FFA500"
+    case strings.Contains(m, ":check:") || strings.Contains(m, ":green:"):
+        themeColor = "2DC72D"
+    }
+
+    for shorthand, emoji := range teamsEmoji {
+        m = strings.ReplaceAll(m, shorthand, emoji)
+    }
+
+    lines := strings.Split(m, "\n")
+    card := teamsCard{
+        Type: "MessageCard",
+        Context: "http://schema.org/extensions",
+        Summary: lines[0],
+        ThemeColor: themeColor,
+        Title: lines[0],
+    }
+
+    var text []string
+    var block []string
+    blockTitle := ""
+    inBlock := false
+
+    for _, line := range lines[1:] {
+        if !strings.HasPrefix(strings.TrimSpace(line), "```") {
+            if inBlock {
+                block = append(block, line)
+            } else if strings.TrimSpace(line) != "" {
+                text = append(text, line)
+            }
+            continue
+        }
+
+        if inBlock {
+            card.Sections = append(card.Sections, teamsSection{ActivityTitle: blockTitle, Text: "<pre>" + html.EscapeString(strings.Join(block, "\n")) + "</pre>"})
+            block = nil
+            inBlock = false
+            continue
+        }
+
+        // Zulip spoilers are written as ```spoiler Title
+        blockTitle = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "```")), "spoiler"))
+        inBlock = true
+    }
+
+    if inBlock && len(block) > 0 {
+        card.Sections = append(card.Sections, teamsSection{ActivityTitle: blockTitle, Text: "<pre>" + html.EscapeString(strings.Join(block, "\n")) + "</pre>"})
+    }
+
+    if len(text) > 0 {
+        card.Sections = append([]teamsSection{{Text: strings.Join(text, "\n\n")}}, card.Sections...)
+    }
+
+    return card
+}
+
+// sendTeamsAlarm posts the alarm to alarm.teams_webhook_url
+func sendTeamsAlarm(m string) error {
+    body, err := json.Marshal(newTeamsCard(m))
+    if err != nil {
+        return err
+    }
+
+    res, err := HTTPClient(10 * time.Second, nil).Post(Config.Alarm.Teams_Webhook_Url, "application/json", bytes.NewBuffer(body))
+    if err != nil {
+        return err
+    }
+    defer res.Body.Close()
+
+    if res.StatusCode < 200 || res.StatusCode > 299 {
+        return errors.New("Teams returned " + res.Status)
+    }
+
+    return nil
+}
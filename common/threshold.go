@@ -0,0 +1,64 @@
+package common
+
+import (
+    "os"
+    "strings"
+)
+
+// Threshold compares a value to separate trigger and clear levels, once
+// triggered it stays triggered until the value drops to the clear level.
+// The state is remembered between runs under Name.
+type Threshold struct {
+    Name string
+    Trigger float64
+    Clear float64
+    // Trigger at the trigger level already and clear only below the clear
+    // level, rather than above and at them
+    Inclusive bool
+}
+
+// NewThreshold returns a Threshold, clearing at the trigger level if clear
+// is not set (0) or above the trigger level.
+func NewThreshold(name string, trigger float64, clear float64) Threshold {
+    if clear == 0 || clear > trigger {
+        clear = trigger
+    }
+
+    return Threshold{Name: name, Trigger: trigger, Clear: clear}
+}
+
+// above reports whether value is past level
+func (t Threshold) above(value float64, level float64) bool {
+    if t.Inclusive {
+        return value >= level
+    }
+    return value > level
+}
+
+func (t Threshold) filePath() string {
+    return TmpDir + "/" + strings.Replace(t.Name, "/", "-", -1) + "-threshold.log"
+}
+
+// State reports whether the threshold is triggered for value.
+func (t Threshold) State(value float64) bool {
+    filePath := t.filePath()
+
+    if FileExists(filePath) {
+        if !t.above(value, t.Clear) {
+            if err := os.Remove(filePath); err != nil {
+                LogError("Error removing threshold state: \n" + err.Error())
+            }
+            return false
+        }
+        return true
+    }
+
+    if t.above(value, t.Trigger) {
+        if err := AtomicWriteFile(filePath, []byte("triggered"), 0644); err != nil {
+            LogError("Error writing threshold state: \n" + err.Error())
+        }
+        return true
+    }
+
+    return false
+}
@@ -0,0 +1,87 @@
+package common
+
+import (
+    "fmt"
+    "time"
+    "strings"
+)
+
+// defaultTimeFormat is used when output.time_format is not set
+const defaultTimeFormat = "2006-01-02 15:04:05"
+
+type durationUnit struct {
+    Duration time.Duration
+    One string
+    Many string
+}
+
+// durationUnits are the units HumanizeDuration uses per output.locale,
+// largest first
+var durationUnits = map[string][]durationUnit{
+    "en": {
+        {24 * time.Hour, "day", "days"},
+        {time.Hour, "hour", "hours"},
+        {time.Minute, "minute", "minutes"},
+        {time.Second, "second", "seconds"},
+    },
+    "tr": {
+        {24 * time.Hour, "gün", "gün"},
+        {time.Hour, "saat", "saat"},
+        {time.Minute, "dakika", "dakika"},
+        {time.Second, "saniye", "saniye"},
+    },
+}
+
+// FormatTime formats t in the local time with output.time_format, a Go
+// time layout
+func FormatTime(t time.Time) string {
+    layout := Config.Output.Time_Format
+    if layout == "" {
+        layout = defaultTimeFormat
+    }
+
+    return t.Local().Format(layout)
+}
+
+// HumanizeDuration returns d in the two largest units in output.locale,
+// eg. "2 days 3 hours" or "5 minutes 10 seconds"
+func HumanizeDuration(d time.Duration) string {
+    units, ok := durationUnits[strings.ToLower(Config.Output.Locale)]
+    if !ok {
+        units = durationUnits["en"]
+    }
+
+    if d < 0 {
+        d = -d
+    }
+
+    var parts []string
+
+    for _, unit := range units {
+        if d < unit.Duration && len(parts) == 0 {
+            continue
+        }
+
+        count := int64(d / unit.Duration)
+        d -= time.Duration(count) * unit.Duration
+
+        if count > 0 {
+            name := unit.Many
+            if count == 1 {
+                name = unit.One
+            }
+            parts = append(parts, fmt.Sprintf("%d %s", count, name))
+        }
+
+        if len(parts) == 2 || (len(parts) == 1 && count == 0) {
+            break
+        }
+    }
+
+    if len(parts) == 0 {
+        last := units[len(units) - 1]
+        return "0 " + last.Many
+    }
+
+    return strings.Join(parts, " ")
+}
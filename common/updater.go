@@ -6,7 +6,6 @@ import (
     "strings"
     "os/exec"
     "runtime"
-    "net/http"
     "archive/tar"
     "encoding/json"
     "compress/gzip"
@@ -32,7 +31,7 @@ func DownloadAndExtract(url string, runMigrations bool, oldVersion string) {
     }
 
     // Download the release
-    resp, err := http.Get(url)
+    resp, err := HTTPClient(0, nil).Get(url)
     if err != nil {
         LogError("Couldn't download the release: " + err.Error())
     }
@@ -99,7 +98,7 @@ func Update(specificVersion string, force bool) {
     } else {
         // Get latest release
         url = "https://api.github.com/repos/monobilisim/monokit/releases/latest"
-        resp, err := http.Get(url)
+        resp, err := HTTPClient(0, nil).Get(url)
         if err != nil {
             LogError("Couldn't get latest release: " + err.Error())
         }
@@ -0,0 +1,55 @@
+package daemon
+
+import (
+    "fmt"
+    "strings"
+    "runtime"
+    "github.com/spf13/cobra"
+    "github.com/monobilisim/monokit/common"
+)
+
+var ComponentsCmd = &cobra.Command{
+    Use: "components",
+    Short: "List the components, whether they are detected on this host and their config keys",
+    Run: func(cmd *cobra.Command, args []string) {
+        common.Init()
+
+        if common.ConfExists("daemon") {
+            common.ConfInit("daemon", &DaemonConfig)
+        }
+
+        for _, component := range Components() {
+            platform := "all"
+            if component.LinuxOnly {
+                platform = "linux"
+            }
+
+            detected := component.Enabled()
+            if component.LinuxOnly && runtime.GOOS != "linux" {
+                detected = false
+            }
+
+            state := common.Fail + "not detected" + common.Reset
+            if detected {
+                state = common.Green + "detected" + common.Reset
+            }
+
+            fmt.Println(common.Blue + component.Name + common.Reset + " (" + platform + ") - " + state)
+
+            if component.Config == "" {
+                continue
+            }
+
+            configState := "missing"
+            if common.ConfExists(component.Config) {
+                configState = "found"
+            }
+
+            fmt.Println("    Config: " + component.Config + ".yml (" + configState + ")")
+
+            if keys := common.ConfigKeys(component.ConfigType); len(keys) > 0 {
+                fmt.Println("    Keys: " + strings.Join(keys, ", "))
+            }
+        }
+    },
+}
@@ -3,6 +3,7 @@
 package daemon
 
 import (
+	"github.com/monobilisim/monokit/assertServices"
 	"github.com/monobilisim/monokit/mysqlHealth"
 	"github.com/monobilisim/monokit/pmgHealth"
 	"github.com/monobilisim/monokit/postalHealth"
@@ -12,6 +13,15 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// linuxConfigTypes are the config types of the Linux only components, they
+// can't be referenced from the platform independent code
+var linuxConfigTypes = map[string]interface{}{
+	"redisHealth": &redisHealth.RedisHealthConfig,
+	"rmqHealth": &rmqHealth.Config,
+	"traefikHealth": &traefikHealth.TraefikHealthConfig,
+	"assertServices": &assertServices.AssertServicesConfig,
+}
+
 func RedisCommandExecute() {
 	var redisHealthCmd = &cobra.Command{
 		Run:   redisHealth.Main,
@@ -39,6 +49,15 @@ func RmqCommandExecute() {
 	rmqHealthCmd.Execute()
 }
 
+func AssertServicesCommandExecute() {
+	var assertServicesCmd = &cobra.Command{
+		Run:   assertServices.Main,
+        DisableFlagParsing: true,
+	}
+
+	assertServicesCmd.Execute()
+}
+
 func PmgCommandExecute() {
 	var pmgHealthCmd = &cobra.Command{
 		Run:   pmgHealth.Main,
@@ -4,13 +4,18 @@ import (
     "os"
     "fmt"
     "time"
+    "strings"
     "os/exec"
     "github.com/spf13/cobra"
     "github.com/monobilisim/monokit/common"
+    db "github.com/monobilisim/monokit/common/db"
+    mail "github.com/monobilisim/monokit/common/mail"
+    issues "github.com/monobilisim/monokit/common/redmine/issues"
     "github.com/monobilisim/monokit/osHealth"
     "github.com/monobilisim/monokit/k8sHealth"
     "github.com/monobilisim/monokit/pritunlHealth"
     "github.com/monobilisim/monokit/wppconnectHealth"
+    "github.com/monobilisim/monokit/commandCheck"
 )
 
 type HealthCheck struct {
@@ -21,6 +26,7 @@ type HealthCheck struct {
 type Daemon struct {
     Frequency int // Frequency to run health checks
     Debug    bool // Debug mode
+    Collect_Only bool // Only observe, without remediation or Redmine issues
     Health_Checks []HealthCheck
 }
 
@@ -63,14 +69,17 @@ func Main(cmd *cobra.Command, args []string) {
         DaemonConfig.Frequency = 60
     }
 
+    common.CollectOnlyMode = common.CollectOnlyMode || DaemonConfig.Collect_Only
 
-    fmt.Println("Monokit daemon - v" + version + " - " + time.Now().Format("2006-01-02 15:04:05"))
+
+    fmt.Println("Monokit daemon - v" + version + " - " + common.FormatTime(time.Now()))
     
     runOnce, _ := cmd.Flags().GetBool("once")
     
     if runOnce {
         fmt.Println("Running once")
         RunAll()
+        common.AlarmFlush()
         os.Exit(0)
     }
     
@@ -81,62 +90,67 @@ func Main(cmd *cobra.Command, args []string) {
 }
 
 
+func healthCommand(run func(cmd *cobra.Command, args []string)) func() {
+    return func() {
+        healthCmd := &cobra.Command{
+            Run: run,
+            DisableFlagParsing: true,
+        }
+        healthCmd.ExecuteC()
+    }
+}
+
+// Components returns the health checks the daemon can run, in the default
+// order. Dependencies are run first regardless of the order here.
+func Components() []common.Component {
+    return []common.Component{
+        {Name: "osHealth", Enabled: func() bool { return true }, Run: healthCommand(osHealth.Main), Config: "os", ConfigType: &osHealth.OsHealthConfig},
+        {Name: "pritunlHealth", Enabled: func() bool { return CommExists("pritunl", false) }, Run: healthCommand(pritunlHealth.Main), Config: "pritunl", ConfigType: &pritunlHealth.PritunlHealthConfig},
+        {Name: "postalHealth", Enabled: func() bool { return CommExists("postal", false) }, Run: PostalCommandExecute, Config: "mail", ConfigType: &mail.MailHealth{}, LinuxOnly: true},
+        {Name: "pmgHealth", Enabled: func() bool { return CommExists("pmgversion", false) }, Run: PmgCommandExecute, Config: "mail", ConfigType: &mail.MailHealth{}, LinuxOnly: true},
+        {Name: "k8sHealth", Enabled: func() bool { return CommExists("k8s", true) }, Run: healthCommand(k8sHealth.Main), Config: "k8s", ConfigType: &k8sHealth.K8sHealthConfig},
+        {Name: "mysqlHealth", Enabled: func() bool { return CommExists("mysqld", false) || CommExists("mariadbd", false) }, Run: MysqlCommandExecute, Config: "db", ConfigType: &db.DbHealth{}, LinuxOnly: true},
+        {Name: "redisHealth", Enabled: func() bool { return CommExists("redis-server", false) }, Run: RedisCommandExecute, Config: "redis", ConfigType: linuxConfigTypes["redisHealth"], LinuxOnly: true},
+        {Name: "rmqHealth", Enabled: func() bool { return CommExists("rabbitmq-server", false) }, Run: RmqCommandExecute, Config: "rabbitmq", ConfigType: linuxConfigTypes["rmqHealth"], LinuxOnly: true},
+        {Name: "traefikHealth", Enabled: func() bool { return CommExists("traefik", false) }, Run: TraefikCommandExecute, Config: "traefik", ConfigType: linuxConfigTypes["traefikHealth"], LinuxOnly: true},
+        {Name: "assertServices", Enabled: func() bool { return common.ConfExists("services") }, Run: AssertServicesCommandExecute, Config: "services", ConfigType: linuxConfigTypes["assertServices"], LinuxOnly: true},
+        {Name: "commandCheck", Enabled: func() bool { return common.ConfExists("commands") }, Run: healthCommand(commandCheck.Main), Config: "commands", ConfigType: &commandCheck.CommandCheckConfig},
+        {Name: "wppconnectHealth", Enabled: func() bool { return CommExists("wppconnect", true) }, Run: healthCommand(wppconnectHealth.Main), Config: "wppconnect", ConfigType: &wppconnectHealth.Config},
+    }
+}
+
 func RunAll() {
 
     common.Update("", false)
-  
+    common.AlarmRetrySpool()
+    common.OutputReset()
 
-    var osHealthCmd = &cobra.Command{
-        Run: osHealth.Main,
-        DisableFlagParsing: true,
+    components, err := common.OrderComponents(Components())
+    if err != nil {
+        common.LogError("Error ordering the health checks, running them in the default order: " + err.Error())
+        components = Components()
     }
-    osHealthCmd.ExecuteC()
-    
-    if CommExists("pritunl", false) {
-        var pritunlHealthCmd = &cobra.Command{
-            Run: pritunlHealth.Main,
-            DisableFlagParsing: true,
-        }
-        pritunlHealthCmd.ExecuteC()
-    } 
 
-    if CommExists("postal", false) {
-        PostalCommandExecute()
-    }
+    ran := make(map[string]bool)
 
-    if CommExists("pmgversion", false) {
-        PmgCommandExecute()
-    }
-    
-    if CommExists("k8s", true) {
-        var k8sHealthCmd = &cobra.Command{
-            Run: k8sHealth.Main,
-            DisableFlagParsing: true,
+    for _, component := range components {
+        if !component.Enabled() {
+            continue
         }
-        k8sHealthCmd.ExecuteC()
-    }
 
-    if CommExists("mysqld", false) || CommExists("mariadbd", false) {
-        MysqlCommandExecute()
-    }
-    
-    if CommExists("redis-server", false) {
-        RedisCommandExecute()
-    }
-   
-    if CommExists("rabbitmq-server", false) {
-        RmqCommandExecute()
-    }
+        // The data the component reads wouldn't be there
+        if missing := component.MissingDependencies(ran); len(missing) > 0 {
+            common.LogError("Skipping " + component.Name + ", its dependencies didn't run: " + strings.Join(missing, ", "))
+            continue
+        }
 
-    if CommExists("traefik", false) {
-        TraefikCommandExecute()
-    }
+        component.Run()
+        ran[component.Name] = true
 
-    if CommExists("wppconnect", true) {
-        wppconnectHealthCmd := &cobra.Command{
-            Run: wppconnectHealth.Main,
-            DisableFlagParsing: true,
-        }
-        wppconnectHealthCmd.ExecuteC()
+        common.CheckStaleness()
+        issues.Flush()
+        common.AlarmGroupFlush()
     }
+
+    common.InventoryReport()
 }
@@ -2,6 +2,9 @@
 
 package daemon
 
+// linuxConfigTypes are the config types of the Linux only components
+var linuxConfigTypes = map[string]interface{}{}
+
 func RedisCommandExecute() {
 	// redisHealth is not supported on anything other than Linux
 	return
@@ -17,6 +20,11 @@ func RmqCommandExecute() {
 	return
 }
 
+func AssertServicesCommandExecute() {
+	// assertServices is not supported on anything other than Linux
+	return
+}
+
 func PmgCommandExecute() {
 	// pmgHealth is not supported on anything other than Linux
 	return
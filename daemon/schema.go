@@ -0,0 +1,57 @@
+package daemon
+
+import (
+    "os"
+    "fmt"
+    "strings"
+    "github.com/spf13/cobra"
+    "github.com/monobilisim/monokit/common"
+    "github.com/monobilisim/monokit/lbPolicy"
+    "github.com/monobilisim/monokit/sshNotifier"
+    mail "github.com/monobilisim/monokit/common/mail"
+)
+
+// schemaConfigs returns the config types by component name, including the
+// global and daemon configs and the components the daemon doesn't run
+func schemaConfigs() (map[string]interface{}, []string) {
+    configs := map[string]interface{}{
+        "global": &common.Common{},
+        "daemon": &Daemon{},
+        "zimbraHealth": &mail.MailHealth{},
+        "sshNotifier": &sshNotifier.SSHNotifierConfig,
+        "glb": &lbPolicy.ConfigStruct{},
+    }
+    names := []string{"global", "daemon", "zimbraHealth", "sshNotifier", "glb"}
+
+    for _, component := range Components() {
+        if component.ConfigType == nil {
+            continue
+        }
+        configs[component.Name] = component.ConfigType
+        names = append(names, component.Name)
+    }
+
+    return configs, names
+}
+
+var SchemaCmd = &cobra.Command{
+    Use: "schema [component]",
+    Short: "Print a commented example config of a component, generated from its config struct",
+    Args: cobra.MaximumNArgs(1),
+    Run: func(cmd *cobra.Command, args []string) {
+        configs, names := schemaConfigs()
+
+        if len(args) == 0 {
+            fmt.Println("Components with a config: " + strings.Join(names, ", "))
+            return
+        }
+
+        config, ok := configs[args[0]]
+        if !ok {
+            common.LogError("Unknown component '" + args[0] + "', expected one of " + strings.Join(names, ", "))
+            os.Exit(1)
+        }
+
+        fmt.Print(common.ConfigSchema(config))
+    },
+}
@@ -6,7 +6,6 @@ import (
     "strings"
     "strconv"
     "context"
-    "net/http"
     "crypto/x509"
     "encoding/pem"
     "path/filepath"
@@ -156,7 +155,7 @@ func CheckRke2IngressNginx() {
     // Test floating IPs
     for _, floatingIp := range K8sHealthConfig.K8s.Ingress_Floating_Ips {
         // equivilant of `curl -o /dev/null -s -w "%{http_code}\n" http://$floatingIp`
-        response, _ := http.Get("http://" + floatingIp)
+        response, _ := common.HTTPClient(0, nil).Get("http://" + floatingIp)
             
         // Get response code
         if response.StatusCode == 404 {
@@ -1,7 +1,6 @@
 package k8sHealth
 
 import (
-    "fmt"
     "time"
     "github.com/spf13/cobra"
     "github.com/monobilisim/monokit/common"
@@ -20,13 +19,13 @@ var K8sHealthConfig K8sHealth
 func Main(cmd *cobra.Command, args []string) {
     version := "2.0.0"
     common.ScriptName = "k8sHealth"
-    common.TmpDir = common.TmpDir + "k8sHealth"
+    common.TmpDir = common.TmpBaseDir + "k8sHealth"
     common.Init()
     common.ConfInit("k8s", &K8sHealthConfig)
 
     kubeconfig, _ := cmd.Flags().GetString("kubeconfig")
 
-    fmt.Println("K8s Health Check REWRITE - v" + version + " - " + time.Now().Format("2006-01-02 15:04:05"))
+    common.Println("K8s Health Check REWRITE - v" + version + " - " + common.FormatTime(time.Now()))
 
     InitClientset(kubeconfig)
 
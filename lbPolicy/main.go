@@ -1,6 +1,7 @@
 package lbPolicy
 
 import (
+    "os"
     "fmt"
     "time"
     "strings" 
@@ -58,13 +59,23 @@ func LoopOverConfigs(server string, configs []string, t string) {
             }
         }
     } else {
-        // Loop over all files at /etc/mono that start with glb-
-        entries, err := ioutil.ReadDir("/etc/mono/")
-        if err != nil {
-            common.LogError(err.Error())
+        // Loop over all files in the config directories that start with glb-
+        var entries []os.FileInfo
+        for _, dir := range common.ConfigDirs() {
+            dirEntries, err := ioutil.ReadDir(dir)
+            if err != nil {
+                if !os.IsNotExist(err) {
+                    common.LogError(err.Error())
+                }
+                continue
+            }
+            entries = append(entries, dirEntries...)
         }
+
+        seen := make(map[string]bool)
         for _, file := range entries {
-            if strings.HasPrefix(file.Name(), "glb-") {
+            if strings.HasPrefix(file.Name(), "glb-") && !seen[file.Name()] {
+                seen[file.Name()] = true
                 ConfReset()
                 fmt.Println("Config: " + file.Name())
                 common.ConfInit(file.Name(), &Config)
@@ -82,7 +93,7 @@ func LoopOverConfigs(server string, configs []string, t string) {
 func Switch(cmd *cobra.Command, args []string) {
     //version := "2.0.0"
     common.ScriptName = "lbPolicy"
-	common.TmpDir = common.TmpDir + "glb"
+	common.TmpDir = common.TmpBaseDir + "glb"
 	common.Init()
     config, _ := cmd.Flags().GetStringArray("configs")
     server, _ := cmd.Flags().GetString("server")
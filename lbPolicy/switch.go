@@ -19,6 +19,13 @@ import (
 
 var noChangesCounter int
 
+// exit delivers the queued alarms before exiting, os.Exit skips the flush
+// in main
+func exit(code int) {
+    common.AlarmFlush()
+    os.Exit(code)
+}
+
 func AlarmCustom(msgType string, message string) {
     customStream := false
 
@@ -52,7 +59,7 @@ func hostnameToURL(hostname string) (string, error) {
 
 func extractHostname(url string) (string, error) {
     
-    resp, err := http.Get(url)
+    resp, err := common.HTTPClient(0, nil).Get(url)
 
     maxRetries := 2
 
@@ -60,7 +67,7 @@ func extractHostname(url string) (string, error) {
         for i := 0; i < maxRetries; i++ {
             err = nil
             fmt.Println("Retrying " + url)
-            resp, err = http.Get(url)
+            resp, err = common.HTTPClient(0, nil).Get(url)
             if err == nil {
                 break
             }
@@ -184,17 +191,17 @@ func SwitchMain(server string) {
 
     if Config.Caddy.Api_Urls == nil || len(Config.Caddy.Api_Urls) == 0 {
         common.LogError("Api_Urls is not defined in caddy config")
-        os.Exit(1)
+        exit(1)
     }
 
     if Config.Caddy.Servers == nil || len(Config.Caddy.Servers) == 0 {
         common.LogError("Servers is not defined in caddy config")
-        os.Exit(1)
+        exit(1)
     }
 
     if (Config.Caddy.Lb_Urls == nil || len(Config.Caddy.Lb_Urls) == 0) && Config.Caddy.Dynamic_Api_Urls {
         common.LogError("Lb_Urls is not defined in caddy config, but Dynamic_Api_Urls is enabled")
-        os.Exit(1)
+        exit(1)
     }
 
     if Config.Caddy.Dynamic_Api_Urls {
@@ -243,7 +250,7 @@ func SwitchMain(server string) {
         AlarmCustom("green_circle", "The URL(s) " + strings.Join(CensoredApiUrls, ", ") + " have been completely switched to " + server)
     } else {
         common.LogError("Invalid loop order")
-        os.Exit(1)
+        exit(1)
     }
 }
 
@@ -325,7 +332,7 @@ func IdentifyRequest(srvArg string, url string, usernamePassword string, urlToFi
     }
 
     req.SetBasicAuth(strings.Split(usernamePassword, ":")[0], strings.Split(usernamePassword, ":")[1])
-    client := &http.Client{Timeout: time.Second * 10}
+    client := common.HTTPClient(10 * time.Second, nil)
    
     maxRetries := 2
     resp, err := client.Do(req)
@@ -441,7 +448,7 @@ func SendRequest(jsonPayload map[string]interface{}, url string, usernamePasswor
 	}
 
 	// Send the request using the HTTP client
-    client := &http.Client{Timeout: time.Second * 10}
+    client := common.HTTPClient(10 * time.Second, nil)
     maxRetries := 2
 	resp, err := client.Do(req)
 
@@ -472,7 +479,7 @@ func SendRequest(jsonPayload map[string]interface{}, url string, usernamePasswor
 func ChangeUpstreams(urlToFind string, switchTo string, identifier string, url string, actualUrl string, server string, routeId int, req map[string]interface{}, UsernamePassword string) {
     if noChangesCounter > Config.Caddy.Nochange_Exit_Threshold {
         fmt.Println("No changes were made for " + strconv.Itoa(noChangesCounter) + " times.")
-        os.Exit(0)
+        exit(0)
     }
 
     reqUrl := actualUrl + "/config/apps/http/servers/" + server + "/routes/" + strconv.Itoa(routeId)
@@ -511,6 +518,7 @@ func ChangeUpstreams(urlToFind string, switchTo string, identifier string, url s
 
                 // Send the request
                 err := SendRequest(reqToSend, reqUrl, UsernamePassword)
+                common.Audit("switch lb_policy to " + switchTo, url, err)
 
                 if err == nil {
                     fmt.Println(url + "'s upstream has been switched to " + switchTo)
@@ -541,6 +549,7 @@ func ChangeUpstreams(urlToFind string, switchTo string, identifier string, url s
             fmt.Println("Sending request to change lb_policy to " + switchTo)
             
             err := SendRequest(reqToSend, reqUrl, UsernamePassword)
+            common.Audit("switch lb_policy to " + switchTo, url, err)
 
             if err == nil {
                 fmt.Println(url + "'s upstream has been switched to " + switchTo)
@@ -551,7 +560,7 @@ func ChangeUpstreams(urlToFind string, switchTo string, identifier string, url s
 
         default:
             common.LogError("Invalid load balancing policy")
-            os.Exit(1)
+            exit(1)
     }
 
     os.MkdirAll("/tmp/glb/" + urlToFind + "/" + identifier, os.ModePerm)
@@ -3,6 +3,7 @@
 package main
 
 import (
+	"github.com/monobilisim/monokit/assertServices"
 	"github.com/monobilisim/monokit/mysqlHealth"
 	"github.com/monobilisim/monokit/pmgHealth"
 	"github.com/monobilisim/monokit/postalHealth"
@@ -24,6 +25,16 @@ func RedisCommandAdd() {
 	RootCmd.AddCommand(redisHealthCmd)
 }
 
+func AssertServicesCommandAdd() {
+	var assertServicesCmd = &cobra.Command{
+		Use:   "assertServices",
+		Short: "Check that the configured systemd units are active",
+		Run:   assertServices.Main,
+	}
+
+	RootCmd.AddCommand(assertServicesCmd)
+}
+
 func ZimbraCommandAdd() {
     var zimbraHealthCmd = &cobra.Command{
         Use:   "zimbraHealth",
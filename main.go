@@ -10,6 +10,7 @@ import (
 	"github.com/monobilisim/monokit/shutdownNotifier"
 	"github.com/monobilisim/monokit/pritunlHealth"
 	"github.com/monobilisim/monokit/sshNotifier"
+	"github.com/monobilisim/monokit/commandCheck"
     "github.com/monobilisim/monokit/lbPolicy"
     "github.com/monobilisim/monokit/wppconnectHealth"
     "github.com/monobilisim/monokit/daemon"
@@ -75,18 +76,35 @@ func main() {
         Run:   lbPolicy.List,
     }
 
+    var commandCheckCmd = &cobra.Command{
+        Use:   "commandCheck",
+        Short: "Run the configured commands and check their results",
+        Run:   commandCheck.Main,
+    }
+
     var wppconnectHealthCmd = &cobra.Command{
         Use:   "wppconnectHealth",
         Short: "WPPConnect Health",
         Run:   wppconnectHealth.Main,
     }
 
+    // Before the daemon command shadows the package
+    RootCmd.AddCommand(daemon.ComponentsCmd)
+    RootCmd.AddCommand(daemon.SchemaCmd)
+
     var daemon = &cobra.Command{
         Use:   "daemon",
         Short: "Daemon",
         Run:   daemon.Main,
     }
 
+	RootCmd.PersistentFlags().StringVar(&common.ConfigDir, "config-dir", "", "Config directory, searched before MONOKIT_CONFIG_DIR and /etc/mono")
+	// -v is the --version of update
+	RootCmd.PersistentFlags().BoolVar(&common.Verbose, "verbose", false, "Log debug messages too, overrides MONOKIT_LOG_LEVEL")
+	RootCmd.PersistentFlags().BoolVarP(&common.Quiet, "quiet", "q", false, "Only log warnings and errors, overrides MONOKIT_LOG_LEVEL")
+	RootCmd.MarkFlagsMutuallyExclusive("verbose", "quiet")
+	RootCmd.PersistentFlags().BoolVar(&common.CollectOnlyMode, "collect-only", false, "Only collect, without restarting services, editing files or creating Redmine issues")
+
 	//// Common
 	RootCmd.AddCommand(redmineCmd)
 	RootCmd.AddCommand(common.AlarmCmd)
@@ -99,6 +117,22 @@ func main() {
     common.MigrateCmd.MarkFlagRequired("from")
     RootCmd.AddCommand(common.MigrateCmd)
 
+    common.ReportCmd.Flags().StringP("format", "f", "md", "Output format (html, md)")
+    RootCmd.AddCommand(common.ReportCmd)
+
+    common.AuditCmd.Flags().IntP("limit", "n", 50, "Number of entries to show, 0 shows all")
+    common.AuditCmd.Flags().StringP("component", "c", "", "Only show the entries of this component")
+    RootCmd.AddCommand(common.AuditCmd)
+
+    common.StateExportCmd.Flags().StringArrayP("component", "c", []string{}, "Only export the state of this component, can be given multiple times")
+    common.StateImportCmd.Flags().StringArrayP("component", "c", []string{}, "Only import the state of this component, can be given multiple times")
+    common.StateCmd.AddCommand(common.StateExportCmd)
+    common.StateCmd.AddCommand(common.StateImportCmd)
+    RootCmd.AddCommand(common.StateCmd)
+
+    common.InventoryCmd.Flags().Bool("post", false, "Post the inventory to inventory.url instead of printing it")
+    RootCmd.AddCommand(common.InventoryCmd)
+
 	/// Alarm
 
 	// AlarmSend
@@ -247,6 +281,9 @@ func main() {
 	/// Pritunl Health
 	RootCmd.AddCommand(pritunlHealthCmd)
 
+    /// Command Check
+    RootCmd.AddCommand(commandCheckCmd)
+
 	RedisCommandAdd()
 
 	MysqlCommandAdd()
@@ -266,6 +303,8 @@ func main() {
 
     ZimbraCommandAdd()
 
+    AssertServicesCommandAdd()
+
 	shutdownNotifierCmd.Flags().BoolP("poweron", "1", false, "Power On")
 	shutdownNotifierCmd.Flags().BoolP("poweroff", "0", false, "Power Off")
 
@@ -293,6 +332,11 @@ func main() {
 	sshNotifierCmd.Flags().BoolP("login", "1", false, "Login")
 	sshNotifierCmd.Flags().BoolP("logout", "0", false, "Logout")
 
+	sshNotifierCmd.AddCommand(sshNotifier.BackfillCmd)
+	sshNotifier.BackfillCmd.Flags().StringP("since", "s", "", "Backfill the logins since this time (YYYY-MM-DD [HH:MM])")
+	sshNotifier.BackfillCmd.MarkFlagRequired("since")
+	sshNotifier.BackfillCmd.Flags().BoolP("dry-run", "n", false, "Only print the logins that would be posted")
+
 	kubeconfig := os.Getenv("KUBECONFIG")
 
 	if kubeconfig == "" {
@@ -301,8 +345,23 @@ func main() {
 
 	k8sHealthCmd.Flags().StringP("kubeconfig", "k", kubeconfig, "Kubeconfig file")
 
-	if err := RootCmd.Execute(); err != nil {
+	err := RootCmd.Execute()
+
+	// After the component has run, its checks have had their chance to
+	// succeed
+	if common.ScriptName != "" {
+		common.CheckStaleness()
+	}
+
+	// Close the recovered Redmine issues and make sure queued alarms are
+	// delivered before exiting
+	issues.Flush()
+	common.AlarmFlush()
+
+	if err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		os.Exit(common.ExitCheckFailed)
 	}
+
+	os.Exit(common.ExitCode())
 }
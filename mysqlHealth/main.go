@@ -3,7 +3,6 @@
 package mysqlHealth
 
 import (
-	"fmt"
 	"time"
 
 	"github.com/monobilisim/monokit/common"
@@ -16,7 +15,7 @@ var DbHealthConfig db.DbHealth
 func Main(cmd *cobra.Command, args []string) {
 	version := "3.1.0"
 	common.ScriptName = "mysqlHealth"
-	common.TmpDir = common.TmpDir + "mysqlHealth"
+	common.TmpDir = common.TmpBaseDir + "mysqlHealth"
 	common.Init()
 	common.ConfInit("db", &DbHealthConfig)
 
@@ -25,7 +24,7 @@ func Main(cmd *cobra.Command, args []string) {
 		DbHealthConfig.Mysql.Cluster.Check_table_hour = "05:00"
 	}
 
-	fmt.Println("MySQL Health Check REWRITE - v" + version + " - " + time.Now().Format("2006-01-02 15:04:05"))
+	common.Println("MySQL Health Check REWRITE - v" + version + " - " + common.FormatTime(time.Now()))
     
     finalConnStr, err := ParseMyCnfAndConnect("client")
 
@@ -37,6 +37,11 @@ func TraefikCommandAdd() {
 	return
 }
 
+func AssertServicesCommandAdd() {
+	// assertServices is not supported on anything other than Linux
+	return
+}
+
 func ZimbraCommandAdd() {
     // zimbraHealth is not supported on anything other than Linux
     return
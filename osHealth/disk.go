@@ -2,6 +2,7 @@ package osHealth
 
 import (
     "os"
+    "path"
     "slices"
     "strconv"
     "strings"
@@ -11,6 +12,27 @@ import (
     issues "github.com/monobilisim/monokit/common/redmine/issues"
 )
 
+// partitionMatches reports whether any of the glob patterns matches the
+// mountpoint, filesystem type or device of the partition.
+func partitionMatches(partition disk.PartitionStat, patterns []string) bool {
+    for _, pattern := range patterns {
+        for _, field := range []string{partition.Mountpoint, partition.Fstype, partition.Device} {
+            if matched, _ := path.Match(pattern, field); matched {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+func partitionIncluded(partition disk.PartitionStat) bool {
+    if len(OsHealthConfig.Disk.Include) > 0 && !partitionMatches(partition, OsHealthConfig.Disk.Include) {
+        return false
+    }
+
+    return !partitionMatches(partition, OsHealthConfig.Disk.Exclude)
+}
+
 func DiskUsage() {
     common.SplitSection("Disk Usage")
 
@@ -29,6 +51,10 @@ func DiskUsage() {
             continue
         }
 
+        if ! partitionIncluded(partition) {
+            continue
+        }
+
         usage, err := disk.Usage(partition.Mountpoint)
 
         if err != nil {
@@ -36,7 +62,9 @@ func DiskUsage() {
             continue
         }
         
-        if usage.UsedPercent > OsHealthConfig.Part_use_limit {
+        diskThreshold := common.NewThreshold("disk_" + partition.Mountpoint, OsHealthConfig.Part_use_limit, OsHealthConfig.Part_use_clear)
+
+        if diskThreshold.State(usage.UsedPercent) {
             common.PrettyPrint("Disk usage at " + partition.Mountpoint, common.Fail + " more than " + strconv.FormatFloat(OsHealthConfig.Part_use_limit, 'f', 0, 64) + "%", usage.UsedPercent, true, false, false, 0)
             exceededParts = append(exceededParts, []string{strconv.FormatFloat(usage.UsedPercent, 'f', 0, 64), common.ConvertBytes(usage.Used), common.ConvertBytes(usage.Total), partition.Device, partition.Mountpoint})
         } else {
@@ -57,13 +85,13 @@ func DiskUsage() {
         
         // Check if file exists 
         if _, err := os.Stat(common.TmpDir + "/" + common.Config.Identifier + "_disk_usage.txt"); os.IsNotExist(err) {
-            os.WriteFile(common.TmpDir + "/" + common.Config.Identifier + "_disk_usage.txt", []byte(msg), 0644)
+            common.AtomicWriteFile(common.TmpDir + "/" + common.Config.Identifier + "_disk_usage.txt", []byte(msg), 0644)
         } else {
             // Read file
             //fileContent, _ := os.ReadFile(common.TmpDir + "/" + common.Config.Identifier + "_disk_usage.txt")
             
             // Write msg to file
-            os.WriteFile(common.TmpDir + "/" + common.Config.Identifier + "_disk_usage.txt", []byte(msg), 0644)
+            common.AtomicWriteFile(common.TmpDir + "/" + common.Config.Identifier + "_disk_usage.txt", []byte(msg), 0644)
         }
 
 
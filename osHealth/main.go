@@ -1,7 +1,6 @@
 package osHealth
 
 import (
-    "fmt"
     "time"
     "github.com/spf13/cobra"
     "github.com/monobilisim/monokit/common"
@@ -12,6 +11,12 @@ type OsHealth struct {
      Filesystems []string 
      System_Load_And_Ram bool
      Part_use_limit float64
+     Part_use_clear float64
+
+     Disk struct {
+         Include []string
+         Exclude []string
+     }
 
      Load struct {
 		 Issue_Interval float64
@@ -31,7 +36,7 @@ var OsHealthConfig OsHealth
 func Main(cmd *cobra.Command, args []string) {
     version := "2.2.2"
     common.ScriptName = "osHealth"
-    common.TmpDir = common.TmpDir + "osHealth"
+    common.TmpDir = common.TmpBaseDir + "osHealth"
     common.Init()
     common.ConfInit("os", &OsHealthConfig)
 
@@ -43,7 +48,11 @@ func Main(cmd *cobra.Command, args []string) {
 		OsHealthConfig.Load.Issue_Interval = 15
 	}
 
-    fmt.Println("OS Health Check REWRITE - v" + version + " - " + time.Now().Format("2006-01-02 15:04:05"))
+    if OsHealthConfig.Disk.Exclude == nil {
+        OsHealthConfig.Disk.Exclude = []string{"squashfs", "overlay", "tmpfs", "/dev/loop*"}
+    }
+
+    common.Println("OS Health Check REWRITE - v" + version + " - " + common.FormatTime(time.Now()))
     
     DiskUsage()
 
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"time"
 	"errors"
-    "net/http"
     "encoding/json"
 	"github.com/spf13/cobra"
 	"github.com/monobilisim/monokit/common"
@@ -19,7 +18,7 @@ var patroniApiUrl string
 func Main(cmd *cobra.Command, args []string) {
 	version := "3.0.0"
 	common.ScriptName = "pgsqlHealth"
-	common.TmpDir = common.TmpDir + "pgsqlHealth"
+	common.TmpDir = common.TmpBaseDir + "pgsqlHealth"
 	common.Init()
 	common.ConfInit("db", &DbHealthConfig)
     
@@ -40,7 +39,7 @@ func Main(cmd *cobra.Command, args []string) {
 		}
 	}
 
-	fmt.Println("PostgreSQL Health Check REWRITE - v" + version + " - " + time.Now().Format("2006-01-02 15:04:05"))
+	common.Println("PostgreSQL Health Check REWRITE - v" + version + " - " + common.FormatTime(time.Now()))
 
 	common.SplitSection("PostgreSQL Access:")
 
@@ -77,7 +76,7 @@ func Main(cmd *cobra.Command, args []string) {
 	    common.SplitSection("Cluster Status:")
 	    clusterStatus()
         // curl -s patroniApiUrl | jq -r .role
-        patroniRole, _ := http.Get(patroniApiUrl + "/patroni")
+        patroniRole, _ := common.HTTPClient(0, nil).Get(patroniApiUrl + "/patroni")
         fmt.Println(patroniRole)
 
         patroniRoleJson := json.NewDecoder(patroniRole.Body)
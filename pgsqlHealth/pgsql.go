@@ -10,7 +10,6 @@ import (
 	"strconv"
 	"strings"
 	"reflect"
-	"net/http"
 	"database/sql"
 	"encoding/json"
 	"gopkg.in/yaml.v3"
@@ -238,7 +237,7 @@ func activeConnections() {
 		}
 		fmt.Println("-----------------", increase)
 		fmt.Println("-----------------", []byte{byte(increase)})
-		err = os.WriteFile(aboveLimitFile, []byte(strconv.Itoa(increase)), 0644)
+		err = common.AtomicWriteFile(aboveLimitFile, []byte(strconv.Itoa(increase)), 0644)
 		if err != nil {
 			common.LogError(fmt.Sprintf("Error writing file: %v\n", err))
 		}
@@ -289,9 +288,7 @@ func clusterStatus() {
 	outputJSON := common.TmpDir + "/raw_output.json"
 	clusterURL := "http://" + patroniApiUrl + "/cluster"
 
-	client := &http.Client{
-		Timeout: time.Second * 10,
-	}
+	client := common.HTTPClient(10 * time.Second, nil)
 
 	resp, err := client.Get(clusterURL)
 	if err != nil {
@@ -0,0 +1,91 @@
+//go:build linux
+package pmgHealth
+
+import (
+    "os"
+    "fmt"
+    "time"
+    "strconv"
+    "github.com/monobilisim/monokit/common"
+    mail "github.com/monobilisim/monokit/common/mail"
+    issues "github.com/monobilisim/monokit/common/redmine/issues"
+)
+
+var defaultCertPorts = []int{8006, 25}
+
+type CertStatusInfo struct {
+    Host string
+    Port int
+    Subject string
+    NotAfter time.Time
+    Days int
+    Error string
+}
+
+// CheckCertificates alarms and opens a Redmine issue for the certificates
+// served on the configured hosts and ports that expire within Expiry_Days.
+func CheckCertificates() []CertStatusInfo {
+    config := MailHealthConfig.Pmg.Cert
+
+    hosts := config.Hosts
+    if len(hosts) == 0 {
+        hostname, err := os.Hostname()
+        if err != nil {
+            common.LogError("Error getting the hostname: " + err.Error())
+            return nil
+        }
+        hosts = []string{hostname}
+    }
+
+    ports := config.Ports
+    if len(ports) == 0 {
+        ports = defaultCertPorts
+    }
+
+    expiryDays := config.Expiry_Days
+    if expiryDays == 0 {
+        expiryDays = 30
+    }
+
+    var certStatus []CertStatusInfo
+
+    for _, host := range hosts {
+        for _, port := range ports {
+            info := CertStatusInfo{Host: host, Port: port}
+            name := host + ":" + strconv.Itoa(port)
+            service := "cert_" + host + "_" + strconv.Itoa(port)
+
+            cert, err := mail.PeerCertificate(host, port)
+            if err != nil {
+                info.Error = err.Error()
+                certStatus = append(certStatus, info)
+                common.PrintCheckFailed("Certificate of " + name, info.Error)
+                continue
+            }
+
+            info.Subject = cert.Subject.CommonName
+            info.NotAfter = cert.NotAfter
+            info.Days = int(time.Until(cert.NotAfter).Hours() / 24)
+            certStatus = append(certStatus, info)
+
+            if info.Days < expiryDays {
+                var state string
+                if info.Days < 0 {
+                    state = fmt.Sprintf("expired %d days ago", -info.Days)
+                } else {
+                    state = fmt.Sprintf("expiring in %d days", info.Days)
+                }
+
+                common.PrettyPrintStr("Certificate of " + name, false, state)
+                common.AlarmCheckDown(service, "Certificate of " + name + " is " + state, false)
+                issues.CheckDown(service, common.Config.Identifier + " için " + name + " sertifikasının süresi doluyor", "Sertifika bitiş tarihi: " + cert.NotAfter.Format("2006-01-02"), false, 0)
+            } else {
+                common.PrettyPrintStr("Certificate of " + name, true, fmt.Sprintf("valid for %d days", info.Days))
+                common.AlarmCheckUp(service, "Certificate of " + name + " is now valid for " + fmt.Sprint(info.Days) + " days", false)
+                issues.CheckUp(service, name + " sertifikası yenilendi, bitiş tarihi: " + cert.NotAfter.Format("2006-01-02"))
+            }
+        }
+    }
+
+    return certStatus
+}
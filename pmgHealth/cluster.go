@@ -0,0 +1,144 @@
+//go:build linux
+package pmgHealth
+
+import (
+    "os"
+    "errors"
+    "context"
+    "strconv"
+    "strings"
+    "encoding/json"
+    "github.com/monobilisim/monokit/common"
+)
+
+type ClusterNodeInfo struct {
+    Name string
+    Ip string
+    Reachable bool
+    StoppedServices []string
+    Queued int
+    Error string
+}
+
+// Services checked on the peer nodes, as named by the PMG API
+var clusterServices = []string{"pmgproxy", "pmg-smtp-filter", "postfix"}
+
+// pmgsh runs a GET on the PMG API and decodes the JSON result into v
+func pmgsh(path string, v interface{}) error {
+    out, stderr, err := common.Runner.Run(context.Background(), "pmgsh", "get", path)
+    if err != nil {
+        return errors.New("pmgsh get " + path + ": " + strings.TrimSpace(err.Error() + " " + stderr))
+    }
+
+    return json.Unmarshal([]byte(out), v)
+}
+
+func clusterNodeStatus(name string, ip string) (ClusterNodeInfo, error) {
+    info := ClusterNodeInfo{Name: name, Ip: ip}
+
+    var services []struct {
+        Service string `json:"service"`
+        Name string `json:"name"`
+        State string `json:"state"`
+    }
+
+    if err := pmgsh("/nodes/" + name + "/services", &services); err != nil {
+        return info, err
+    }
+
+    info.Reachable = true
+
+    for _, service := range services {
+        if common.IsInArray(service.Service, clusterServices) && service.State != "running" {
+            info.StoppedServices = append(info.StoppedServices, service.Service)
+        }
+    }
+
+    var qshape []struct {
+        Domain string `json:"domain"`
+        Total int `json:"total"`
+    }
+
+    if err := pmgsh("/nodes/" + name + "/postfix/qshape", &qshape); err != nil {
+        return info, err
+    }
+
+    for _, row := range qshape {
+        if row.Domain == "TOTAL" {
+            info.Queued = row.Total
+        }
+    }
+
+    return info, nil
+}
+
+// CheckCluster queries the other PMG cluster nodes for their services and
+// mail queue and alarms for the unhealthy ones.
+func CheckCluster() []ClusterNodeInfo {
+    var nodes []struct {
+        Name string `json:"name"`
+        Ip string `json:"ip"`
+        Type string `json:"type"`
+    }
+
+    if err := pmgsh("/config/cluster/nodes", &nodes); err != nil {
+        common.PrintCheckFailed("Cluster nodes", err.Error())
+        return nil
+    }
+
+    if len(nodes) == 0 {
+        common.Println("No cluster defined, skipping.")
+        return nil
+    }
+
+    hostname, _ := os.Hostname()
+
+    var clusterNodes []ClusterNodeInfo
+
+    for _, node := range nodes {
+        if node.Name == hostname {
+            continue
+        }
+
+        service := "cluster_" + node.Name
+
+        info, err := clusterNodeStatus(node.Name, node.Ip)
+        if err != nil {
+            info.Error = err.Error()
+        }
+        clusterNodes = append(clusterNodes, info)
+
+        if err != nil {
+            common.PrettyPrintStr(node.Name, false, "reachable")
+            common.AlarmCheckDown(service, "Cluster node " + node.Name + " (" + node.Ip + ") is not reachable: " + err.Error(), false)
+            continue
+        }
+
+        common.AlarmCheckUp(service, "Cluster node " + node.Name + " (" + node.Ip + ") is reachable again", false)
+
+        for _, svc := range clusterServices {
+            nodeService := service + "_" + svc
+
+            if common.IsInArray(svc, info.StoppedServices) {
+                common.PrettyPrintStr(node.Name + " " + svc, false, "running")
+                common.AlarmCheckDown(nodeService, svc + " is not running on cluster node " + node.Name, false)
+            } else {
+                common.PrettyPrintStr(node.Name + " " + svc, true, "running")
+                common.AlarmCheckUp(nodeService, svc + " is running again on cluster node " + node.Name, false)
+            }
+        }
+
+        queueThreshold := common.NewThreshold("queued_msg_" + node.Name, float64(MailHealthConfig.Pmg.Queue_Limit), float64(MailHealthConfig.Pmg.Queue_Clear))
+        queueStr := strconv.Itoa(info.Queued) + "/" + strconv.Itoa(MailHealthConfig.Pmg.Queue_Limit)
+
+        if queueThreshold.State(float64(info.Queued)) {
+            common.PrettyPrintStr(node.Name + " queued messages", false, queueStr)
+            common.AlarmCheckDown(service + "_queued_msg", "Number of queued messages on cluster node " + node.Name + " is above limit - " + queueStr, false)
+        } else {
+            common.PrettyPrintStr(node.Name + " queued messages", true, queueStr)
+            common.AlarmCheckUp(service + "_queued_msg", "Number of queued messages on cluster node " + node.Name + " is acceptable - " + queueStr, false)
+        }
+    }
+
+    return clusterNodes
+}
@@ -0,0 +1,78 @@
+//go:build linux
+package pmgHealth
+
+import (
+    "fmt"
+    "github.com/shirou/gopsutil/v4/disk"
+    "github.com/monobilisim/monokit/common"
+    issues "github.com/monobilisim/monokit/common/redmine/issues"
+)
+
+var defaultDiskPaths = []string{"/var/spool/pmg", "/var/lib/pmg", "/var/lib/postgresql"}
+
+type DiskStatusInfo struct {
+    Path string
+    Total uint64
+    Free uint64
+    UsedPercent float64
+    Error string
+}
+
+func diskStatus(path string) (DiskStatusInfo, error) {
+    info := DiskStatusInfo{Path: path}
+
+    usage, err := disk.Usage(path)
+    if err != nil {
+        return info, err
+    }
+
+    // Free leaves out the reserved blocks, they are not usable by PMG
+    info.Total = usage.Total
+    info.Free = usage.Free
+    info.UsedPercent = usage.UsedPercent
+
+    return info, nil
+}
+
+// CheckDiskSpace alarms when the usage of the filesystem of a PMG path,
+// eg. the spool or the PostgreSQL data, is above Part_Use_Limit.
+func CheckDiskSpace() []DiskStatusInfo {
+    paths := MailHealthConfig.Pmg.Disk.Paths
+    if len(paths) == 0 {
+        paths = defaultDiskPaths
+    }
+
+    limit := MailHealthConfig.Pmg.Disk.Part_Use_Limit
+    if limit == 0 {
+        limit = 90
+    }
+
+    var statuses []DiskStatusInfo
+
+    for _, path := range paths {
+        info, err := diskStatus(path)
+        if err != nil {
+            info.Error = err.Error()
+            statuses = append(statuses, info)
+            common.PrintCheckFailed(path, info.Error)
+            continue
+        }
+
+        statuses = append(statuses, info)
+
+        service := "disk_" + path
+        usage := fmt.Sprintf("%.0f%% used, %s free", info.UsedPercent, common.ConvertBytes(info.Free))
+
+        if info.UsedPercent > limit {
+            common.PrettyPrintStr(path, false, usage)
+            common.AlarmCheckDown(service, "Disk usage of " + path + " is above " + fmt.Sprintf("%.0f%%", limit) + ": " + usage, false)
+            issues.CheckDown(service, common.Config.Identifier + " için " + path + " disk kullanımı yüksek", path + " disk kullanımı: " + fmt.Sprintf("%.0f%%", info.UsedPercent), false, 0)
+        } else {
+            common.PrettyPrintStr(path, true, usage)
+            common.AlarmCheckUp(service, "Disk usage of " + path + " is back below " + fmt.Sprintf("%.0f%%", limit) + ": " + usage, false)
+            issues.CheckUp(service, path + " disk kullanımı normale döndü: " + fmt.Sprintf("%.0f%%", info.UsedPercent))
+        }
+    }
+
+    return statuses
+}
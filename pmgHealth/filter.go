@@ -0,0 +1,131 @@
+//go:build linux
+package pmgHealth
+
+import (
+    "os"
+    "fmt"
+    "regexp"
+    "strconv"
+    "strings"
+    "github.com/shirou/gopsutil/v4/process"
+    psnet "github.com/shirou/gopsutil/v4/net"
+    "github.com/monobilisim/monokit/common"
+    issues "github.com/monobilisim/monokit/common/redmine/issues"
+)
+
+// pmgFilterPorts are the ports postfix hands the mail to pmg-smtp-filter
+// on, 10023 for the outgoing and 10024 for the incoming mail
+var pmgFilterPorts = []uint32{10023, 10024}
+
+type FilterWorkers struct {
+    Workers int
+    Busy int
+    MaxWorkers int
+}
+
+// filterMaxWorkers reads max_filters from pmg.conf, 15 is the default of PMG
+func filterMaxWorkers() int {
+    conf, err := os.ReadFile("/etc/pmg/pmg.conf")
+    if err != nil {
+        return 15
+    }
+
+    match := regexp.MustCompile(`(?m)^\s*max_filters\s+(\d+)`).FindSubmatch(conf)
+    if match == nil {
+        return 15
+    }
+
+    maxFilters, err := strconv.Atoi(string(match[1]))
+    if err != nil || maxFilters == 0 {
+        return 15
+    }
+
+    return maxFilters
+}
+
+// filterWorkers counts the pmg-smtp-filter processes except for the master
+func filterWorkers() int {
+    procs, _ := process.Processes()
+    workers := 0
+
+    for _, proc := range procs {
+        cmdline, err := proc.Cmdline()
+        if err != nil || !strings.HasPrefix(cmdline, "pmg-smtp-filter") {
+            continue
+        }
+
+        workers++
+    }
+
+    if workers > 0 {
+        workers--
+    }
+
+    return workers
+}
+
+// filterBusy counts the established connections to the filter ports, each
+// one is a worker handling a message
+func filterBusy() (int, error) {
+    conns, err := psnet.Connections("tcp")
+    if err != nil {
+        return 0, err
+    }
+
+    busy := 0
+
+    for _, conn := range conns {
+        if conn.Status != "ESTABLISHED" {
+            continue
+        }
+
+        for _, port := range pmgFilterPorts {
+            if conn.Laddr.Port == port {
+                busy++
+                break
+            }
+        }
+    }
+
+    return busy, nil
+}
+
+// CheckFilterWorkers alarms when all of the pmg-smtp-filter workers have
+// been busy for Filter.Confirm_After, mail queues up while the service is
+// still running.
+func CheckFilterWorkers() FilterWorkers {
+    var info FilterWorkers
+
+    confirmAfter := MailHealthConfig.Pmg.Filter.Confirm_After
+    if confirmAfter.Checks == 0 && confirmAfter.Minutes == 0 {
+        confirmAfter.Checks = 3
+    }
+
+    busy, err := filterBusy()
+    if err != nil {
+        common.LogError("Error getting the pmg-smtp-filter connections: " + err.Error())
+        return info
+    }
+
+    info.Busy = busy
+    info.Workers = filterWorkers()
+    info.MaxWorkers = filterMaxWorkers()
+
+    workers := fmt.Sprint(info.Busy) + "/" + fmt.Sprint(info.MaxWorkers) + " busy"
+    saturated := info.Busy >= info.MaxWorkers
+
+    if !saturated {
+        common.ConfirmDown("pmg_filter_saturated", false, 0, 0)
+        common.PrettyPrintStr("Filter workers", true, "available (" + workers + ")")
+        common.AlarmCheckUp("pmg_filter_saturated", "pmg-smtp-filter is no longer saturated, " + workers, false)
+        issues.CheckUp("pmg_filter_saturated", "pmg-smtp-filter kapasitesi normale döndü, meşgul işçi: " + workers)
+    } else if !common.ConfirmDown("pmg_filter_saturated", true, confirmAfter.Checks, confirmAfter.Minutes) {
+        common.PrettyPrintStr("Filter workers", false, "available (" + workers + ", waiting to confirm)")
+    } else {
+        common.PrettyPrintStr("Filter workers", false, "available (" + workers + ")")
+        common.AlarmCheckDown("pmg_filter_saturated", "pmg-smtp-filter is saturated, " + workers, false)
+        issues.CheckDown("pmg_filter_saturated", common.Config.Identifier + " için pmg-smtp-filter kapasitesi doldu", "Meşgul işçi: " + workers + "\nÇalışan işçi: " + fmt.Sprint(info.Workers), false, 0)
+    }
+
+    return info
+}
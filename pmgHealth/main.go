@@ -2,12 +2,12 @@
 package pmgHealth
 
 import (
-    "fmt"
     "time"
-    "bytes"
+    "errors"
     "regexp"
+    "context"
     "strconv"
-    "os/exec"
+    "strings"
     "github.com/spf13/cobra"
     "github.com/monobilisim/monokit/common"
     mail "github.com/monobilisim/monokit/common/mail"
@@ -16,23 +16,40 @@ import (
 
 var MailHealthConfig mail.MailHealth
 
-func CheckPmgServices() {
+// CheckPmgServices returns false if a critical service is not running,
+// advisory services are alarmed for but don't affect the result.
+func CheckPmgServices() bool {
     pmgServices := []string{"pmgproxy.service", "pmg-smtp-filter.service", "postfix@-.service"}
+    healthy := true
+
+    confirmAfter := MailHealthConfig.Pmg.Confirm_After
 
     for _, service := range pmgServices {
-        if common.SystemdUnitActive(service) {
+        active := common.SystemdUnitActive(service)
+
+        if active {
+            common.ConfirmDown(service, false, 0, 0)
             common.PrettyPrintStr(service, true, "running")
             common.AlarmCheckUp(service, service + " is working again", false)
+        } else if !common.ConfirmDown(service, true, confirmAfter.Checks, confirmAfter.Minutes) {
+            common.PrettyPrintStr(service, false, "running (waiting to confirm)")
         } else {
             common.PrettyPrintStr(service, false, "running")
-            common.AlarmCheckDown(service, service + " is not running", false)
+
+            if common.IsInArray(service, MailHealthConfig.Pmg.Advisory_Services) {
+                common.AlarmCheckDownAdvisory(service, service + " is not running", false)
+            } else {
+                common.AlarmCheckDown(service, service + " is not running", false)
+                healthy = false
+            }
         }
     }
+
+    return healthy
 }
 
 func PostgreSQLStatus() {
-    cmd := exec.Command("pg_isready", "-q")
-    err := cmd.Run()
+    _, _, err := common.Runner.Run(context.Background(), "pg_isready", "-q")
     if err != nil {
         common.AlarmCheckDown("postgres", "PostgreSQL is not running", false)
         common.PrettyPrintStr("PostgreSQL", false, "running")
@@ -42,56 +59,118 @@ func PostgreSQLStatus() {
     }
 }
 
+// queuedMessages counts the messages listed by mailq, truncated is set when
+// the output was cut at the output limit and the count is a lower bound
+func queuedMessages() (count int, truncated bool, err error) {
+    out, _, err := common.Runner.Run(context.Background(), "mailq")
+
+    truncated = common.OutputTruncated(err)
+    if truncated {
+        err = errors.Unwrap(err)
+    }
+
+    if err != nil {
+        return 0, truncated, err
+    }
+
+    // The queue IDs start the lines of the messages
+    re := regexp.MustCompile("^[A-F0-9]")
+
+    for _, line := range strings.Split(out, "\n") {
+        if re.MatchString(line) {
+            count++
+        }
+    }
+
+    return count, truncated, nil
+}
+
 func QueuedMessages() {
-    // Execute the mailq command
-	cmd := exec.Command("mailq")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
+	count, truncated, err := queuedMessages()
+
 	if err != nil {
 		common.LogError("Error running mailq: " + err.Error())
         common.AlarmCheckDown("mailq_run", "Error running mailq: " + err.Error(), false)
+        common.SetExitCode(common.ExitCheckFailed)
 		return
 	} else {
         common.AlarmCheckUp("mailq_run", "mailq command executed successfully", false)
+        common.CheckSucceeded("mailq")
     }
 
-	// Compile a regex to match lines that start with A-F or 0-9
-	re := regexp.MustCompile("^[A-F0-9]")
-
-	// Split the output into lines and count matches
-	lines := bytes.Split(out.Bytes(), []byte("\n"))
-	count := 0
-	for _, line := range lines {
-		if re.Match(line) {
-			count++
-		}
-	}
-
-    if count < MailHealthConfig.Pmg.Queue_Limit {
-        common.AlarmCheckUp("queued_msg", "Number of queued messages is acceptable - " + strconv.Itoa(count) + "/" + strconv.Itoa(MailHealthConfig.Pmg.Queue_Limit), false)
-        common.PrettyPrintStr("Number of queued messages", true, strconv.Itoa(count) + "/" + strconv.Itoa(MailHealthConfig.Pmg.Queue_Limit))
+    queueThreshold := common.NewThreshold("queued_msg", float64(MailHealthConfig.Pmg.Queue_Limit), float64(MailHealthConfig.Pmg.Queue_Clear))
+    // The PMG queue alarms at the limit already
+    queueThreshold.Inclusive = true
+
+    countStr := strconv.Itoa(count)
+    if truncated {
+        countStr = "at least " + countStr
+    }
+
+    if !queueThreshold.State(float64(count)) {
+        common.AlarmCheckUp("queued_msg", "Number of queued messages is acceptable - " + countStr + "/" + strconv.Itoa(MailHealthConfig.Pmg.Queue_Limit), false)
+        common.PrettyPrintStr("Number of queued messages", true, countStr + "/" + strconv.Itoa(MailHealthConfig.Pmg.Queue_Limit))
     } else {
-        common.AlarmCheckDown("queued_msg", "Number of queued messages is above limit - " + strconv.Itoa(count) + "/" + strconv.Itoa(MailHealthConfig.Pmg.Queue_Limit), false)
-        common.PrettyPrintStr("PMG Queue", true, strconv.Itoa(count) + "/" + strconv.Itoa(MailHealthConfig.Pmg.Queue_Limit))
+        common.AlarmCheckDown("queued_msg", "Number of queued messages is above limit - " + countStr + "/" + strconv.Itoa(MailHealthConfig.Pmg.Queue_Limit), false)
+        common.PrettyPrintStr("PMG Queue", true, countStr + "/" + strconv.Itoa(MailHealthConfig.Pmg.Queue_Limit))
     }
 }
 
 func Main(cmd *cobra.Command, args []string) {
     version := "2.0.0"
     common.ScriptName = "pmgHealth"
-    common.TmpDir = common.TmpDir + "pmgHealth"
+    common.TmpDir = common.TmpBaseDir + "pmgHealth"
     common.Init()
     common.ConfInit("mail", &MailHealthConfig)
 
-    fmt.Println("PMG Health Check REWRITE - v" + version + " - " + time.Now().Format("2006-01-02 15:04:05"))
+    common.Println("PMG Health Check REWRITE - v" + version + " - " + common.FormatTime(time.Now()))
 
     common.SplitSection("PMG Services")
-    CheckPmgServices()
+    healthy := CheckPmgServices()
+
+    common.SplitSection("Postfix Instances")
+    CheckPostfixInstances()
 
     common.SplitSection("PostgreSQL Status")
     PostgreSQLStatus()
 
     common.SplitSection("Queued Messages")
     QueuedMessages()
+
+    common.SplitSection("SMTP Filter")
+    CheckFilterWorkers()
+
+    common.SplitSection("Disk Space")
+    CheckDiskSpace()
+
+    if MailHealthConfig.Pmg.Cluster.Enabled {
+        common.SplitSection("Cluster Nodes")
+        CheckCluster()
+    }
+
+    if MailHealthConfig.Pmg.Cert.Enabled {
+        common.SplitSection("Certificates")
+        CheckCertificates()
+    }
+
+    common.SplitSection("Rule Updates")
+    CheckRuleFreshness()
+
+    if MailHealthConfig.Pmg.Rbl.Enabled {
+        common.SplitSection("RBL Status")
+        CheckRbl()
+    }
+
+    if MailHealthConfig.Bounce_Rate.Enabled {
+        common.SplitSection("Bounce Rate")
+        mail.CheckBounceRate(MailHealthConfig.Bounce_Rate, "/var/log/mail.log")
+    }
+
+    if MailHealthConfig.Tls_Audit.Enabled {
+        common.SplitSection("TLS Audit")
+        mail.CheckTLSAudit(MailHealthConfig.Tls_Audit)
+    }
+
+    common.SplitSection("Overall Health")
+    common.PrettyPrintStr("PMG", healthy, "healthy")
 }
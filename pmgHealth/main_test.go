@@ -0,0 +1,53 @@
+//go:build linux
+package pmgHealth
+
+import (
+    "errors"
+    "testing"
+    "github.com/monobilisim/monokit/common"
+)
+
+const testMailq = `-Queue ID-  --Size-- ----Arrival Time---- -Sender/Recipient-------
+4F2A31C0A2*    1234 Thu Oct 16 10:00:00  sender@example.com
+                                         rcpt@example.com
+
+A1B2C3D4E5!    5678 Thu Oct 16 10:01:00  sender@example.com
+                                         rcpt@example.com
+
+B7C8D9E0F1     910 Thu Oct 16 10:02:00  sender@example.com
+(host mx.example.com[192.0.2.1] said: 451 4.7.1 Try again later)
+                                         rcpt@example.com
+
+-- 8 Kbytes in 3 Requests.
+`
+
+func TestQueuedMessages(t *testing.T) {
+    truncatedErr := &common.OutputTruncatedError{Command: "mailq", Limit: 1024}
+    failedErr := errors.New("exit status 69")
+
+    tests := []struct {
+        name string
+        result common.FakeResult
+        count int
+        truncated bool
+        err error
+    }{
+        {"empty", common.FakeResult{Stdout: "Mail queue is empty\n"}, 0, false, nil},
+        {"messages", common.FakeResult{Stdout: testMailq}, 3, false, nil},
+        {"truncated", common.FakeResult{Stdout: testMailq, Err: truncatedErr}, 3, true, nil},
+        {"failed", common.FakeResult{Err: failedErr}, 0, false, failedErr},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            previous := common.Runner
+            common.Runner = &common.FakeRunner{Results: map[string]common.FakeResult{"mailq": test.result}}
+            t.Cleanup(func() { common.Runner = previous })
+
+            count, truncated, err := queuedMessages()
+            if count != test.count || truncated != test.truncated || !errors.Is(err, test.err) {
+                t.Errorf("got %d, %t, %v, want %d, %t, %v", count, truncated, err, test.count, test.truncated, test.err)
+            }
+        })
+    }
+}
@@ -0,0 +1,76 @@
+//go:build linux
+package pmgHealth
+
+import (
+    "context"
+    "strings"
+    "github.com/monobilisim/monokit/common"
+)
+
+type PostfixInstanceInfo struct {
+    Name string
+    ConfigDir string
+    Enabled bool
+    Running bool
+}
+
+// postfixInstances parses `postmulti -l`, falling back to the default
+// instance when postmulti is not available
+func postfixInstances() []PostfixInstanceInfo {
+    out, _, err := common.Runner.Run(context.Background(), "postmulti", "-l")
+    if err != nil {
+        return []PostfixInstanceInfo{{Name: "-", ConfigDir: "/etc/postfix", Enabled: true}}
+    }
+
+    var instances []PostfixInstanceInfo
+
+    // name group enabled config_directory
+    for _, line := range strings.Split(out, "\n") {
+        fields := strings.Fields(line)
+        if len(fields) < 4 {
+            continue
+        }
+
+        instances = append(instances, PostfixInstanceInfo{
+            Name: fields[0],
+            ConfigDir: fields[3],
+            Enabled: fields[2] == "y",
+        })
+    }
+
+    return instances
+}
+
+// CheckPostfixInstances alarms for each enabled postfix instance whose
+// master process is not running.
+func CheckPostfixInstances() []PostfixInstanceInfo {
+    instances := postfixInstances()
+
+    for i, instance := range instances {
+        name := instance.Name
+        if name == "-" {
+            name = "postfix"
+        }
+
+        if !instance.Enabled {
+            common.PrettyPrintStr(name, true, "disabled")
+            continue
+        }
+
+        // postfix status exits nonzero when the master process is not running
+        _, _, err := common.Runner.Run(context.Background(), "postfix", "-c", instance.ConfigDir, "status")
+        instances[i].Running = err == nil
+
+        service := "postfix_instance_" + name
+
+        if instances[i].Running {
+            common.PrettyPrintStr(name, true, "running")
+            common.AlarmCheckUp(service, "Postfix instance " + name + " (" + instance.ConfigDir + ") is running again", false)
+        } else {
+            common.PrettyPrintStr(name, false, "running")
+            common.AlarmCheckDown(service, "Postfix instance " + name + " (" + instance.ConfigDir + ") is not running", false)
+        }
+    }
+
+    return instances
+}
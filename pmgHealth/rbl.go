@@ -0,0 +1,190 @@
+//go:build linux
+package pmgHealth
+
+import (
+    "io"
+    "net"
+    "time"
+    "strings"
+    "github.com/monobilisim/monokit/common"
+    netcheck "github.com/monobilisim/monokit/common/netcheck"
+    issues "github.com/monobilisim/monokit/common/redmine/issues"
+)
+
+var defaultRblLists = []string{"zen.spamhaus.org", "b.barracudacentral.org", "bl.spamcop.net"}
+
+// rblCacheVersion is the schema version of the RBL cache
+const rblCacheVersion = 1
+
+type RblResult struct {
+    Listed bool `json:"listed"`
+    Checked string `json:"checked"`
+}
+
+func rblCachePath() string {
+    return common.TmpDir + "/rbl_cache.json"
+}
+
+func loadRblCache() map[string]RblResult {
+    cache := make(map[string]RblResult)
+
+    if !common.LoadCache(rblCachePath(), rblCacheVersion, &cache) {
+        return make(map[string]RblResult)
+    }
+
+    return cache
+}
+
+func saveRblCache(cache map[string]RblResult) {
+    err := common.SaveCache(rblCachePath(), rblCacheVersion, cache)
+    if err != nil {
+        common.LogError("Error writing RBL cache: " + err.Error())
+    }
+}
+
+func publicIps() []string {
+    if len(MailHealthConfig.Pmg.Rbl.Public_Ips) > 0 {
+        return MailHealthConfig.Pmg.Rbl.Public_Ips
+    }
+
+    client := common.HTTPClient(10 * time.Second, nil)
+
+    // The plain text endpoint, ifconfig.co returns HTML to our User-Agent
+    resp, err := client.Get("https://ifconfig.co/ip")
+    if err != nil {
+        common.LogError("Error getting external IP: " + err.Error())
+        return nil
+    }
+
+    defer resp.Body.Close()
+
+    respBody, err := io.ReadAll(resp.Body)
+    if err != nil {
+        common.LogError("Error reading external IP: " + err.Error())
+        return nil
+    }
+
+    ip := strings.TrimSpace(string(respBody))
+    if net.ParseIP(ip) == nil {
+        common.LogError("Error getting external IP: unexpected response from ifconfig.co")
+        return nil
+    }
+
+    return []string{ip}
+}
+
+// rblQueryName returns the DNSBL query name for ip on the given zone
+func rblQueryName(ip string, list string) (string, error) {
+    parsed := net.ParseIP(ip).To4()
+    if parsed == nil {
+        return "", &net.AddrError{Err: "not an IPv4 address", Addr: ip}
+    }
+
+    return net.IPv4(parsed[3], parsed[2], parsed[1], parsed[0]).String() + "." + list, nil
+}
+
+// rblListed returns whether the lookup result means the IP is listed. An
+// error is returned when the zone could not give a definitive answer.
+func rblListed(result netcheck.LookupResult) (bool, error) {
+    if result.Err != nil {
+        if dnsErr, ok := result.Err.(*net.DNSError); ok && dnsErr.IsNotFound {
+            return false, nil
+        }
+        return false, result.Err
+    }
+
+    for _, addr := range result.Addrs {
+        // 127.255.255.x is used by Spamhaus to report query errors, eg. open resolvers
+        if strings.HasPrefix(addr, "127.255.255.") {
+            return false, &net.DNSError{Err: "DNSBL refused the query (" + addr + ")", Name: result.Host}
+        }
+        if strings.HasPrefix(addr, "127.") {
+            return true, nil
+        }
+    }
+
+    return false, nil
+}
+
+func CheckRbl() {
+    lists := MailHealthConfig.Pmg.Rbl.Lists
+    if len(lists) == 0 {
+        lists = defaultRblLists
+    }
+
+    cacheMinutes := MailHealthConfig.Pmg.Rbl.Cache_Minutes
+    if cacheMinutes == 0 {
+        cacheMinutes = 60
+    }
+
+    queryDelay := time.Duration(MailHealthConfig.Pmg.Rbl.Query_Delay_Ms) * time.Millisecond
+    if queryDelay == 0 {
+        queryDelay = 200 * time.Millisecond
+    }
+
+    cache := loadRblCache()
+    ips := publicIps()
+
+    // Query the expired entries first, concurrently
+    var queries []string
+    queryKeys := make(map[string]string)
+
+    for _, ip := range ips {
+        for _, list := range lists {
+            key := ip + "|" + list
+            result, cached := cache[key]
+
+            checked, err := time.Parse(time.RFC3339, result.Checked)
+            if cached && err == nil && time.Since(checked).Minutes() < cacheMinutes {
+                continue
+            }
+
+            query, err := rblQueryName(ip, list)
+            if err != nil {
+                common.LogError("Error querying " + list + " for " + ip + ": " + err.Error())
+                continue
+            }
+
+            queries = append(queries, query)
+            queryKeys[query] = key
+        }
+    }
+
+    resolver := netcheck.NewResolver()
+    resolver.Delay = queryDelay
+
+    for _, lookup := range resolver.LookupHosts(queries) {
+        key := queryKeys[lookup.Host]
+
+        listed, err := rblListed(lookup)
+        if err != nil {
+            common.LogError("Error querying " + strings.Replace(key, "|", " on ", 1) + ": " + err.Error())
+            continue
+        }
+
+        cache[key] = RblResult{Listed: listed, Checked: time.Now().Format(time.RFC3339)}
+    }
+
+    for _, ip := range ips {
+        for _, list := range lists {
+            result, cached := cache[ip + "|" + list]
+            if !cached {
+                continue
+            }
+
+            service := "rbl_" + ip + "_" + list
+
+            if result.Listed {
+                common.PrettyPrintStr(ip + " on " + list, false, "clean")
+                common.AlarmCheckDown(service, ip + " is listed on " + list, false)
+                issues.CheckDown(service, common.Config.Identifier + " için " + ip + " adresi " + list + " kara listesinde", ip + " adresi " + list + " kara listesinde bulundu.", false, 0)
+            } else {
+                common.PrettyPrintStr(ip + " on " + list, true, "clean")
+                common.AlarmCheckUp(service, ip + " is no longer listed on " + list, false)
+                issues.CheckUp(service, ip + " adresi artık " + list + " kara listesinde değil, kapatılıyor.")
+            }
+        }
+    }
+
+    saveRblCache(cache)
+}
@@ -0,0 +1,98 @@
+//go:build linux
+package pmgHealth
+
+import (
+    "fmt"
+    "time"
+    "io/fs"
+    "path/filepath"
+    "github.com/monobilisim/monokit/common"
+)
+
+var defaultRulePaths = []string{"/var/lib/spamassassin", "/var/lib/clamav"}
+
+type RuleFreshnessInfo struct {
+    Path string
+    LastUpdate time.Time
+    AgeDays float64
+    Error string
+}
+
+// ruleFreshness returns the most recent modification time of the files
+// under path.
+func ruleFreshness(path string) (RuleFreshnessInfo, error) {
+    info := RuleFreshnessInfo{Path: path}
+
+    err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+
+        if d.IsDir() {
+            return nil
+        }
+
+        fileInfo, err := d.Info()
+        if err != nil {
+            return err
+        }
+
+        if fileInfo.ModTime().After(info.LastUpdate) {
+            info.LastUpdate = fileInfo.ModTime()
+        }
+
+        return nil
+    })
+
+    if err != nil {
+        return info, err
+    }
+
+    if info.LastUpdate.IsZero() {
+        return info, fmt.Errorf("no files found in %s", path)
+    }
+
+    info.AgeDays = time.Since(info.LastUpdate).Hours() / 24
+
+    return info, nil
+}
+
+func CheckRuleFreshness() []RuleFreshnessInfo {
+    paths := MailHealthConfig.Pmg.Rule_Freshness.Paths
+    if len(paths) == 0 {
+        paths = defaultRulePaths
+    }
+
+    maxDays := MailHealthConfig.Pmg.Rule_Freshness.Max_Days
+    if maxDays == 0 {
+        maxDays = 7
+    }
+
+    var infos []RuleFreshnessInfo
+
+    for _, path := range paths {
+        service := "rule_freshness_" + path
+
+        info, err := ruleFreshness(path)
+        if err != nil {
+            info.Error = err.Error()
+            infos = append(infos, info)
+            common.PrintCheckFailed("Rules in " + path, info.Error)
+            continue
+        }
+
+        infos = append(infos, info)
+
+        lastUpdate := common.FormatTime(info.LastUpdate)
+
+        if info.AgeDays > maxDays {
+            common.PrettyPrintStr("Rules in " + path, false, "up to date (last update " + lastUpdate + ")")
+            common.AlarmCheckDown(service, "Rules in " + path + " have not been updated for " + common.HumanizeDuration(time.Since(info.LastUpdate)) + " (last update " + lastUpdate + ")", false)
+        } else {
+            common.PrettyPrintStr("Rules in " + path, true, "up to date (last update " + lastUpdate + ")")
+            common.AlarmCheckUp(service, "Rules in " + path + " are up to date again (last update " + lastUpdate + ")", false)
+        }
+    }
+
+    return infos
+}
@@ -25,12 +25,12 @@ var MessageDB *sql.DB
 func Main(cmd *cobra.Command, args []string) {
     version := "3.0.0"
     common.ScriptName = "postalHealth"
-    common.TmpDir = common.TmpDir + "postalHealth"
+    common.TmpDir = common.TmpBaseDir + "postalHealth"
     common.Init()
     viper.SetDefault("postal.check_message", true)
     common.ConfInit("mail", &MailHealthConfig)
 
-    fmt.Println("Postal Health Check REWRITE - v" + version + " - " + time.Now().Format("2006-01-02 15:04:05"))
+    common.Println("Postal Health Check REWRITE - v" + version + " - " + common.FormatTime(time.Now()))
     
     common.SplitSection("Postal Status:")
     Services()
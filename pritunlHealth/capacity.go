@@ -0,0 +1,52 @@
+package pritunlHealth
+
+import (
+    "fmt"
+    "time"
+    "context"
+    "go.mongodb.org/mongo-driver/v2/bson"
+    "go.mongodb.org/mongo-driver/v2/mongo"
+    "github.com/monobilisim/monokit/common"
+    issues "github.com/monobilisim/monokit/common/redmine/issues"
+)
+
+// connectedClients returns the number of connected clients across all
+// servers, only counting the fresh ones if a freshness window is set
+func connectedClients(ctx context.Context, db *mongo.Database) (int64, error) {
+    filter := bson.D{}
+
+    if PritunlHealthConfig.Client_Freshness_Minutes != 0 {
+        since := time.Now().Add(-time.Duration(PritunlHealthConfig.Client_Freshness_Minutes * float64(time.Minute)))
+        filter = bson.D{{Key: "timestamp", Value: bson.D{{Key: "$gte", Value: bson.NewDateTimeFromTime(since)}}}}
+    }
+
+    return db.Collection("clients").CountDocuments(ctx, filter)
+}
+
+// ClientCapacity alarms when the number of connected clients is above
+// Max_Clients
+func ClientCapacity(ctx context.Context, db *mongo.Database) {
+    if PritunlHealthConfig.Max_Clients == 0 {
+        return
+    }
+
+    common.SplitSection("Client Capacity")
+
+    count, err := connectedClients(ctx, db)
+    if err != nil {
+        common.LogError("Couldn't count the connected clients: " + err.Error())
+        return
+    }
+
+    usage := fmt.Sprint(count) + "/" + fmt.Sprint(PritunlHealthConfig.Max_Clients)
+
+    if count > int64(PritunlHealthConfig.Max_Clients) {
+        common.PrettyPrintStr("Connected clients", false, "within capacity (" + usage + ")")
+        common.AlarmCheckDown("client_capacity", "Number of connected clients is above the capacity - " + usage, false)
+        issues.CheckDown("client_capacity", common.Config.Identifier + " için Pritunl bağlı istemci sayısı kapasiteyi aştı", "Bağlı istemci sayısı: " + usage, false, 0)
+    } else {
+        common.PrettyPrintStr("Connected clients", true, "within capacity (" + usage + ")")
+        common.AlarmCheckUp("client_capacity", "Number of connected clients is within the capacity again - " + usage, false)
+        issues.CheckUp("client_capacity", "Bağlı istemci sayısı tekrar kapasite dahilinde: " + usage)
+    }
+}
@@ -0,0 +1,127 @@
+package pritunlHealth
+
+import (
+    "fmt"
+    "time"
+    "slices"
+    "errors"
+    "context"
+    "crypto/x509"
+    "encoding/pem"
+    "go.mongodb.org/mongo-driver/v2/bson"
+    "go.mongodb.org/mongo-driver/v2/mongo"
+    "github.com/monobilisim/monokit/common"
+    issues "github.com/monobilisim/monokit/common/redmine/issues"
+)
+
+func certExpiry(pemData string) (time.Time, error) {
+    block, _ := pem.Decode([]byte(pemData))
+    if block == nil {
+        return time.Time{}, errors.New("no PEM block found")
+    }
+
+    cert, err := x509.ParseCertificate(block.Bytes)
+    if err != nil {
+        return time.Time{}, err
+    }
+
+    return cert.NotAfter, nil
+}
+
+// checkCertificates alarms for the certificates in the given collection that
+// expire within the configured window, returns the number of expiring ones.
+// An error is returned if the collection couldn't be read in full.
+func checkCertificates(ctx context.Context, db *mongo.Database, collectionName string, field string, kind string) (int, error) {
+    collection := db.Collection(collectionName)
+
+    cursor, err := collection.Find(ctx, bson.D{})
+    if err != nil {
+        return 0, err
+    }
+
+    defer cursor.Close(ctx)
+
+    expiring := 0
+
+    for nextWithinDeadline(ctx, cursor, collectionName) {
+        var result bson.M
+        err := cursor.Decode(&result)
+        if err != nil {
+            return expiring, err
+        }
+
+        name, _ := result["name"].(string)
+        certificate, _ := result[field].(string)
+
+        if name == "" || name == "undefined" || certificate == "" {
+            continue
+        }
+
+        if kind == "org" {
+            if len(PritunlHealthConfig.Allowed_orgs) > 0 && !slices.Contains(PritunlHealthConfig.Allowed_orgs, name) {
+                continue
+            }
+        } else {
+            orgId, ok := result["org_id"].(bson.ObjectID)
+            if !ok || !OrgCheck(orgId, ctx, db) {
+                continue
+            }
+        }
+
+        notAfter, err := certExpiry(certificate)
+        if err != nil {
+            common.LogError("Couldn't parse the certificate of " + kind + " " + name + ": " + err.Error())
+            continue
+        }
+
+        days := int(time.Until(notAfter).Hours() / 24)
+        service := "cert_" + kind + "_" + name
+
+        if days < PritunlHealthConfig.Cert_Expiry_Days {
+            expiring++
+
+            var state string
+            if days < 0 {
+                state = fmt.Sprintf("expired %d days ago", -days)
+            } else {
+                state = fmt.Sprintf("expiring in %d days", days)
+            }
+
+            common.Println(common.Blue + "Certificate of " + kind + " " + name + common.Reset + " is " + common.Fail + state + common.Reset)
+            common.AlarmCheckDown(service, "Certificate of " + kind + " " + name + " is " + state, false)
+            issues.CheckDown(service, common.Config.Identifier + " için Pritunl " + kind + " " + name + " sertifikasının süresi doluyor", "Sertifika bitiş tarihi: " + notAfter.Format("2006-01-02"), false, 0)
+        } else {
+            common.AlarmCheckUp(service, "Certificate of " + kind + " " + name + " is now valid for " + fmt.Sprint(days) + " days", false)
+            issues.CheckUp(service, "Pritunl " + kind + " " + name + " sertifikası yenilendi, bitiş tarihi: " + notAfter.Format("2006-01-02"))
+        }
+    }
+
+    if ctx.Err() != nil {
+        return expiring, ctx.Err()
+    }
+
+    return expiring, cursor.Err()
+}
+
+func CertificateStatus(ctx context.Context, db *mongo.Database) {
+    common.SplitSection("Expiring Certificates")
+
+    expiring := 0
+
+    for _, check := range []struct{ collection, field, kind string }{
+        {"organizations", "ca_certificate", "org"},
+        {"users", "certificate", "user"},
+    } {
+        count, err := checkCertificates(ctx, db, check.collection, check.field, check.kind)
+        expiring += count
+
+        if err != nil {
+            common.PrintCheckFailed("Certificates", "couldn't get the " + check.collection + " collection: " + err.Error())
+            return
+        }
+    }
+
+    if expiring == 0 {
+        common.PrettyPrintStr("Certificates", true, "valid for more than " + fmt.Sprint(PritunlHealthConfig.Cert_Expiry_Days) + " days")
+    }
+}
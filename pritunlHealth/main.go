@@ -3,9 +3,12 @@ package pritunlHealth
 import (
     "fmt"
     "time"
+    "errors"
     "slices"
+    "strings"
 	"context"
     "github.com/spf13/cobra"
+    "github.com/spf13/viper"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
     "github.com/monobilisim/monokit/common"
@@ -17,6 +20,16 @@ import (
 type PritunlHealth struct {
 	Url string
     Allowed_orgs []string
+    Cert_Expiry_Days int
+    Client_Freshness_Minutes float64
+    Max_Clients int
+    Timeout float64
+
+    Org_Connections struct {
+        Alarm bool
+        Start_Hour int
+        End_Hour int
+    }
 }
 
 var PritunlHealthConfig PritunlHealth
@@ -24,33 +37,55 @@ var PritunlHealthConfig PritunlHealth
 func Main(cmd *cobra.Command, args []string) {
     version := "1.0.0"
     common.ScriptName = "pritunlHealth"
-    common.TmpDir = common.TmpDir + "pritunlHealth"
+    common.TmpDir = common.TmpBaseDir + "pritunlHealth"
     common.Init()
+
+    // The daemon runs Main repeatedly in the same process
+    incompleteCollections = nil
 	
-	if common.ConfExists("pritunl") {
-    	common.ConfInit("pritunl", &PritunlHealthConfig)
+	_, err := common.ConfInitE("pritunl", &PritunlHealthConfig)
+	if err != nil {
+		// The config is optional, the defaults below are used without it
+		if !errors.As(err, &viper.ConfigFileNotFoundError{}) {
+			common.LogError("Couldn't load the pritunl config: " + err.Error())
+			common.SetExitCode(common.ExitCheckFailed)
+			return
+		}
 	}
 
 	if PritunlHealthConfig.Url == "" {
 		PritunlHealthConfig.Url = "mongodb://localhost:27017"
 	}
 
-    fmt.Println("Pritunl Health Check - v" + version + " - " + time.Now().Format("2006-01-02 15:04:05"))
+	if PritunlHealthConfig.Timeout == 0 {
+		PritunlHealthConfig.Timeout = 10
+	}
+
+	if PritunlHealthConfig.Cert_Expiry_Days == 0 {
+		PritunlHealthConfig.Cert_Expiry_Days = 30
+	}
+
+    common.Println("Pritunl Health Check - v" + version + " - " + common.FormatTime(time.Now()))
 
 	client, err := mongo.Connect(options.Client().ApplyURI(PritunlHealthConfig.Url))
 	if err != nil {
 		common.LogError("Couldn't connect to the server: " + err.Error())
 		common.AlarmCheckDown("pritunl_connect", "Couldn't connect to the server: " + err.Error(), false)
+		common.SetExitCode(common.ExitCheckFailed)
 		return
 	} else {
 		common.AlarmCheckUp("pritunl_connect", "Server is now connected", false)
 	}
 	
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(PritunlHealthConfig.Timeout * float64(time.Second)))
 	defer cancel()
 	
 	defer func() {
-    	if err = client.Disconnect(ctx); err != nil {
+		// ctx may have already expired, disconnect with a context of its own
+		disconnectCtx, disconnectCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer disconnectCancel()
+
+    	if err = client.Disconnect(disconnectCtx); err != nil {
         	panic(err)
     	}
 	}()
@@ -59,6 +94,7 @@ func Main(cmd *cobra.Command, args []string) {
 	if err != nil {
 		common.LogError("Couldn't ping the server: " + err.Error())
 		common.AlarmCheckDown("pritunl_ping", "Couldn't ping the server: " + err.Error(), false)
+		common.SetExitCode(common.ExitCheckFailed)
 		return
 	} else {
 		common.AlarmCheckUp("pritunl_ping", "Server is now pingable", false)
@@ -69,9 +105,54 @@ func Main(cmd *cobra.Command, args []string) {
 
     ServerStatus(ctx, db)
     UsersStatus(ctx, db)
+    ClientCapacity(ctx, db)
+    OrganizationStatus(ctx, db)
+    CertificateStatus(ctx, db)
+
+    if len(incompleteCollections) > 0 {
+        common.LogError("Deadline of " + fmt.Sprint(PritunlHealthConfig.Timeout) + "s exceeded, results are incomplete for: " + strings.Join(incompleteCollections, ", "))
+        common.AlarmCheckDown("pritunl_deadline", "Health check exceeded its " + fmt.Sprint(PritunlHealthConfig.Timeout) + "s deadline, results are incomplete for: " + strings.Join(incompleteCollections, ", "), false)
+    } else {
+        common.AlarmCheckUp("pritunl_deadline", "Health check completed within its " + fmt.Sprint(PritunlHealthConfig.Timeout) + "s deadline", false)
+        common.CheckSucceeded("pritunl")
+    }
 }
 
-func ClientUpCheck(userIdActual bson.ObjectID, ctx context.Context, db *mongo.Database) int {
+// incompleteCollections lists the collections that could not be read in
+// full before the deadline.
+var incompleteCollections []string
+
+// nextWithinDeadline advances the cursor unless the deadline of ctx has
+// passed, in which case the collection is recorded as incomplete.
+func nextWithinDeadline(ctx context.Context, cursor *mongo.Cursor, collection string) bool {
+    if ctx.Err() == nil && cursor.Next(ctx) {
+        return true
+    }
+
+    if ctx.Err() != nil && !slices.Contains(incompleteCollections, collection) {
+        incompleteCollections = append(incompleteCollections, collection)
+    }
+
+    return false
+}
+
+// clientFresh reports whether the client has been active within the
+// configured freshness window, clients are always fresh if it is not set.
+func clientFresh(client bson.M) bool {
+    if PritunlHealthConfig.Client_Freshness_Minutes == 0 {
+        return true
+    }
+
+    timestamp, ok := client["timestamp"].(bson.DateTime)
+    if !ok {
+        return false
+    }
+
+    return time.Since(timestamp.Time()).Minutes() <= PritunlHealthConfig.Client_Freshness_Minutes
+}
+
+// ClientUpCheck returns the number of connected and stale clients of the user
+func ClientUpCheck(userIdActual bson.ObjectID, ctx context.Context, db *mongo.Database) (int, int) {
     
     // Get to the clients collection
     collection := db.Collection("clients")
@@ -81,7 +162,7 @@ func ClientUpCheck(userIdActual bson.ObjectID, ctx context.Context, db *mongo.Da
     if err != nil {
         common.LogError("Couldn't get the collection: " + err.Error())
         common.AlarmCheckDown("pritunl_clients", "Couldn't get the clients collection: " + err.Error(), false)
-        return 0
+        return 0, 0
     } else {
         common.AlarmCheckUp("pritunl_clients", "Clients collection is now available", false)
     }
@@ -89,24 +170,29 @@ func ClientUpCheck(userIdActual bson.ObjectID, ctx context.Context, db *mongo.Da
     defer cursor.Close(ctx)
 
     counter := 0
+    stale := 0
 
-    for cursor.Next(ctx) {
+    for nextWithinDeadline(ctx, cursor, "clients") {
         var result bson.M
         err := cursor.Decode(&result)
         if err != nil {
             fmt.Println("Error: " + err.Error())
-            return 0
+            return 0, 0
         }
     
         // Get user_id
         userId := result["user_id"]
 
         if userId == userIdActual {
-            counter++
+            if clientFresh(result) {
+                counter++
+            } else {
+                stale++
+            }
         }
     }
 
-    return counter
+    return counter, stale
 }
 
 func OrgCheck(orgIdActual bson.ObjectID, ctx context.Context, db *mongo.Database) bool {
@@ -125,7 +211,7 @@ func OrgCheck(orgIdActual bson.ObjectID, ctx context.Context, db *mongo.Database
 
     defer cursor.Close(ctx)
 
-    for cursor.Next(ctx) {
+    for nextWithinDeadline(ctx, cursor, "organizations") {
         var result bson.M
         err := cursor.Decode(&result)
         if err != nil {
@@ -181,7 +267,7 @@ func UsersStatus(ctx context.Context, db *mongo.Database) {
 
     defer cursor.Close(ctx)
 
-    for cursor.Next(ctx) {
+    for nextWithinDeadline(ctx, cursor, "users") {
         var result bson.M
         err := cursor.Decode(&result)
         if err != nil {
@@ -202,10 +288,19 @@ func UsersStatus(ctx context.Context, db *mongo.Database) {
         }
 
         // Get id
-        isUp := ClientUpCheck(result["_id"].(bson.ObjectID), ctx, db)
+        isUp, stale := ClientUpCheck(result["_id"].(bson.ObjectID), ctx, db)
+
+        // Don't report users offline based on a partial clients collection
+        if ctx.Err() != nil {
+            break
+        }
+
+        if stale > 0 {
+            common.Println(common.Blue + "User " + name + " has " + common.Fail + fmt.Sprint(stale) + " stale client(s)" + common.Reset)
+        }
 
         if isUp == 0 {
-            fmt.Println(common.Blue + "User " + name + " is " + common.Fail + "offline" + common.Reset)
+            common.Println(common.Blue + "User " + name + " is " + common.Fail + "offline" + common.Reset)
             common.AlarmCheckDown("user_" + name, "User " + name + " is offline, no client is connected", false)
         } else {
             common.PrettyPrintStr("User " + name, true, "online")
@@ -232,7 +327,7 @@ func ServerStatus(ctx context.Context, db *mongo.Database) {
 
 	defer cursor.Close(ctx)
 
-	for cursor.Next(ctx) {
+	for nextWithinDeadline(ctx, cursor, "servers") {
 		var result bson.M
 		err := cursor.Decode(&result)
 		if err != nil {
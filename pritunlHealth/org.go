@@ -0,0 +1,155 @@
+package pritunlHealth
+
+import (
+    "fmt"
+    "time"
+    "slices"
+    "strconv"
+    "strings"
+    "context"
+    "github.com/olekukonko/tablewriter"
+    "go.mongodb.org/mongo-driver/v2/bson"
+    "go.mongodb.org/mongo-driver/v2/mongo"
+    "github.com/monobilisim/monokit/common"
+)
+
+type OrganizationInfo struct {
+    Name string
+    TotalUsers int
+    ConnectedUsers int
+}
+
+func findAll(ctx context.Context, db *mongo.Database, collectionName string) ([]bson.M, error) {
+    cursor, err := db.Collection(collectionName).Find(ctx, bson.D{})
+    if err != nil {
+        return nil, err
+    }
+
+    defer cursor.Close(ctx)
+
+    var results []bson.M
+    for nextWithinDeadline(ctx, cursor, collectionName) {
+        var result bson.M
+        if err := cursor.Decode(&result); err != nil {
+            return results, err
+        }
+        results = append(results, result)
+    }
+
+    // The deadline stops the loop without an error on the cursor, the
+    // results are only a part of the collection then
+    if ctx.Err() != nil {
+        return results, ctx.Err()
+    }
+
+    return results, cursor.Err()
+}
+
+// inExpectedHours reports whether the current hour is within the configured
+// start and end hours, the range may wrap around midnight.
+func inExpectedHours() bool {
+    start := PritunlHealthConfig.Org_Connections.Start_Hour
+    end := PritunlHealthConfig.Org_Connections.End_Hour
+    hour := time.Now().Hour()
+
+    if start <= end {
+        return hour >= start && hour < end
+    }
+
+    return hour >= start || hour < end
+}
+
+func OrganizationStatus(ctx context.Context, db *mongo.Database) {
+    common.SplitSection("Organization Status")
+
+    organizations, err := findAll(ctx, db, "organizations")
+    if err != nil {
+        common.PrintCheckFailed("Organizations", "couldn't get the organizations collection: " + err.Error())
+        return
+    }
+
+    users, err := findAll(ctx, db, "users")
+    if err != nil {
+        common.PrintCheckFailed("Organizations", "couldn't get the users collection: " + err.Error())
+        return
+    }
+
+    clients, err := findAll(ctx, db, "clients")
+    if err != nil {
+        common.PrintCheckFailed("Organizations", "couldn't get the clients collection: " + err.Error())
+        return
+    }
+
+    connectedClients := make(map[bson.ObjectID]int)
+    for _, client := range clients {
+        if userId, ok := client["user_id"].(bson.ObjectID); ok && clientFresh(client) {
+            connectedClients[userId]++
+        }
+    }
+
+    var orgIds []bson.ObjectID
+    orgInfos := make(map[bson.ObjectID]*OrganizationInfo)
+
+    for _, org := range organizations {
+        id, ok := org["_id"].(bson.ObjectID)
+        name, _ := org["name"].(string)
+
+        if !ok || name == "" || name == "undefined" {
+            continue
+        }
+
+        if len(PritunlHealthConfig.Allowed_orgs) > 0 && !slices.Contains(PritunlHealthConfig.Allowed_orgs, name) {
+            continue
+        }
+
+        orgIds = append(orgIds, id)
+        orgInfos[id] = &OrganizationInfo{Name: name}
+    }
+
+    for _, user := range users {
+        name, _ := user["name"].(string)
+        orgId, _ := user["org_id"].(bson.ObjectID)
+        userId, _ := user["_id"].(bson.ObjectID)
+
+        info, ok := orgInfos[orgId]
+        if !ok || name == "" || name == "undefined" {
+            continue
+        }
+
+        info.TotalUsers++
+        if connectedClients[userId] > 0 {
+            info.ConnectedUsers++
+        }
+    }
+
+    var rows [][]string
+
+    for _, id := range orgIds {
+        info := orgInfos[id]
+        rows = append(rows, []string{info.Name, strconv.Itoa(info.TotalUsers), strconv.Itoa(info.ConnectedUsers)})
+
+        if !PritunlHealthConfig.Org_Connections.Alarm {
+            continue
+        }
+
+        // No connected users is only alarmed within the expected hours, the
+        // alarm still clears outside of them once users connect
+        if info.ConnectedUsers == 0 && info.TotalUsers > 0 {
+            if inExpectedHours() {
+                common.AlarmCheckDown("org_" + info.Name, "Organization " + info.Name + " has no connected users", false)
+            }
+        } else {
+            common.AlarmCheckUp("org_" + info.Name, "Organization " + info.Name + " now has " + fmt.Sprint(info.ConnectedUsers) + " connected user(s)", false)
+        }
+    }
+
+    output := &strings.Builder{}
+    table := tablewriter.NewWriter(output)
+    table.SetHeader([]string{"Organization", "Users", "Connected"})
+    table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
+    table.SetCenterSeparator("|")
+    table.AppendBulk(rows)
+    table.Render()
+
+    fmt.Fprint(common.Output, output.String())
+}
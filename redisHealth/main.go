@@ -3,7 +3,6 @@
 package redisHealth
 
 import (
-	"fmt"
 	"time"
 
 	"github.com/monobilisim/monokit/common"
@@ -19,7 +18,7 @@ var RedisHealthConfig struct {
 func Main(cmd *cobra.Command, args []string) {
 	version := "0.2.0"
 	common.ScriptName = "redisHealth"
-	common.TmpDir = common.TmpDir + "redisHealth"
+	common.TmpDir = common.TmpBaseDir + "redisHealth"
 	common.Init()
 	common.ConfInit("redis", &RedisHealthConfig)
 
@@ -27,7 +26,7 @@ func Main(cmd *cobra.Command, args []string) {
 		RedisHealthConfig.Port = "6379"
 	}
 
-	fmt.Println("Redis Health - v" + version + " - " + time.Now().Format("2006-01-02 15:04:05"))
+	common.Println("Redis Health - v" + version + " - " + common.FormatTime(time.Now()))
 
 	common.SplitSection("Main")
 
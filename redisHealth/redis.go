@@ -88,7 +88,7 @@ func redisAlarmRoleChange(isMaster bool) {
 		// File doesn't exist, create it and write the role and return
 
 		// Write the role
-		err := os.WriteFile(common.TmpDir+"/redis_role", []byte(fmt.Sprintf("%t", isMaster)), 0644)
+		err := common.AtomicWriteFile(common.TmpDir+"/redis_role", []byte(fmt.Sprintf("%t", isMaster)), 0644)
 		if err != nil {
 			common.LogError("Error while writing to file: " + err.Error())
 			return
@@ -110,7 +110,7 @@ func redisAlarmRoleChange(isMaster bool) {
 			return
 		} else {
 			// Role is changed, write the new role and return
-			err := os.WriteFile(common.TmpDir+"/redis_role", []byte(fmt.Sprintf("%t", isMaster)), 0644)
+			err := common.AtomicWriteFile(common.TmpDir+"/redis_role", []byte(fmt.Sprintf("%t", isMaster)), 0644)
 
 			if err != nil {
 				common.LogError("Error while writing to file: " + err.Error())
@@ -82,7 +82,7 @@ func clusterCheck() {
 func Main(cmd *cobra.Command, args []string) {
 	version := "0.1.0"
 	common.ScriptName = "rmqHealth"
-	common.TmpDir = common.TmpDir + "rmqHealth"
+	common.TmpDir = common.TmpBaseDir + "rmqHealth"
 	common.Init()
 
     if common.ConfExists("rabbitmq") {
@@ -97,7 +97,7 @@ func Main(cmd *cobra.Command, args []string) {
         Config.Password = "guest"
     }
 
-	fmt.Println("RabbitMQ Health - v" + version + " - " + time.Now().Format("2006-01-02 15:04:05"))
+	common.Println("RabbitMQ Health - v" + version + " - " + common.FormatTime(time.Now()))
 
     serviceCheck()
     
@@ -0,0 +1,57 @@
+package sshNotifier
+
+import (
+    "net"
+    "strings"
+)
+
+// AllowRule silences the notification of the logins matching all of its
+// set fields, eg. a backup system logging in with its key from a known
+// address. The logins are still recorded to the database.
+type AllowRule struct {
+    User string
+    Ip string
+    Key_Comment string
+}
+
+// ipMatches compares ip to a single address or a CIDR range
+func ipMatches(ip string, rule string) bool {
+    if strings.Contains(rule, "/") {
+        _, network, err := net.ParseCIDR(rule)
+        parsed := net.ParseIP(ip)
+        return err == nil && parsed != nil && network.Contains(parsed)
+    }
+
+    return ip == rule
+}
+
+func (rule AllowRule) matches(loginInfo LoginInfoOutput) bool {
+    // A rule without any fields would silence every login
+    if rule.User == "" && rule.Ip == "" && rule.Key_Comment == "" {
+        return false
+    }
+
+    if rule.User != "" && rule.User != loginInfo.PamUser {
+        return false
+    }
+
+    if rule.Ip != "" && !ipMatches(loginInfo.RemoteIp, rule.Ip) {
+        return false
+    }
+
+    if rule.Key_Comment != "" && (loginInfo.LoginMethod != "ssh-key" || rule.Key_Comment != loginInfo.Username) {
+        return false
+    }
+
+    return true
+}
+
+// loginAllowed reports whether the login matches one of the allow rules
+func loginAllowed(loginInfo LoginInfoOutput) bool {
+    for _, rule := range SSHNotifierConfig.Allow {
+        if rule.matches(loginInfo) {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,338 @@
+package sshNotifier
+
+import (
+    "io"
+    "os"
+    "fmt"
+    "time"
+    "bufio"
+    "regexp"
+    "strings"
+    "os/exec"
+    "path/filepath"
+    "compress/gzip"
+    "github.com/spf13/cobra"
+    "github.com/spf13/viper"
+    "github.com/monobilisim/monokit/common"
+)
+
+var BackfillCmd = &cobra.Command{
+    Use: "backfill",
+    Short: "Post the logins missing from the database, read from the auth logs",
+    Run: func(cmd *cobra.Command, args []string) {
+        common.ScriptName = "sshNotifier"
+        common.Init()
+        viper.SetDefault("webhook.modify_stream", true)
+        viper.SetDefault("webhook.stream", "ssh")
+        common.ConfInit("ssh-notifier", &SSHNotifierConfig)
+
+        sinceStr, _ := cmd.Flags().GetString("since")
+        dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+        since, err := time.ParseInLocation("2006-01-02 15:04", sinceStr, time.Local)
+        if err != nil {
+            since, err = time.ParseInLocation("2006-01-02", sinceStr, time.Local)
+        }
+        if err != nil {
+            common.LogError("Invalid --since '" + sinceStr + "', expected YYYY-MM-DD [HH:MM]")
+            os.Exit(1)
+        }
+
+        Backfill(since, dryRun)
+    },
+}
+
+// loginRecordVersion is the schema version of the posted logins record
+const loginRecordVersion = 1
+
+// loginRecordDays is how long the posted logins are remembered
+const loginRecordDays = 90
+
+type loginRecord struct {
+    Ppid string
+    Type string
+    Date time.Time
+}
+
+func loginRecordPath() string {
+    return common.TmpBaseDir + "sshNotifier/logins.json"
+}
+
+func loadLoginRecords() []loginRecord {
+    var records []loginRecord
+    if !common.LoadCache(loginRecordPath(), loginRecordVersion, &records) {
+        return nil
+    }
+    return records
+}
+
+// recordLogin remembers a posted login, so backfill doesn't post it again.
+// The PAM hook runs for every login, so the record is locked while it is
+// updated.
+func recordLogin(ppid string, loginType string, date time.Time) {
+    if err := os.MkdirAll(filepath.Dir(loginRecordPath()), 0755); err != nil {
+        common.LogError("Error creating the sshNotifier state directory: " + err.Error())
+        return
+    }
+
+    unlock, err := common.LockFile(loginRecordPath() + ".lock")
+    if err != nil {
+        common.LogError("Error locking the posted logins: " + err.Error())
+        return
+    }
+    defer unlock()
+
+    var records []loginRecord
+
+    for _, record := range loadLoginRecords() {
+        if time.Since(record.Date) < loginRecordDays * 24 * time.Hour {
+            records = append(records, record)
+        }
+    }
+
+    records = append(records, loginRecord{Ppid: ppid, Type: loginType, Date: date})
+
+    if err := common.SaveCache(loginRecordPath(), loginRecordVersion, records); err != nil {
+        common.LogError("Error saving the posted logins: " + err.Error())
+    }
+}
+
+// loginRecorded reports whether the login was already posted, the PAM hook
+// runs a few seconds after the log line is written
+func loginRecorded(records []loginRecord, ppid string, loginType string, date time.Time) bool {
+    for _, record := range records {
+        if record.Ppid == ppid && record.Type == loginType && record.Date.Sub(date).Abs() < time.Minute {
+            return true
+        }
+    }
+    return false
+}
+
+// sshdLine matches the sshd lines of both the traditional syslog and the
+// ISO 8601 timestamp formats
+var sshdLine = regexp.MustCompile(`^(\w{3}\s+\d+ \d{2}:\d{2}:\d{2}|\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\S*) \S+ sshd\[(\d+)\]: (.*)$`)
+var acceptedLine = regexp.MustCompile(`^Accepted (\S+) for (\S+) from (\S+) port \d+(?: \S+: \S+ (\S+))?`)
+var sessionLine = regexp.MustCompile(`^pam_unix\(sshd:session\): session (opened|closed) for user ([^\s(]+)`)
+
+func parseLogDate(date string) (time.Time, error) {
+    if parsed, err := time.Parse(time.RFC3339, date); err == nil {
+        return parsed.Local(), nil
+    }
+
+    // The traditional format has no year, assume the last occurrence
+    parsed, err := time.ParseInLocation("2006 Jan 2 15:04:05", fmt.Sprint(time.Now().Year()) + " " + strings.Join(strings.Fields(date), " "), time.Local)
+    if err != nil {
+        return parsed, err
+    }
+
+    if parsed.After(time.Now().Add(24 * time.Hour)) {
+        parsed = parsed.AddDate(-1, 0, 0)
+    }
+
+    return parsed, nil
+}
+
+// readAuthLog calls fn with every line of the auth logs including the
+// rotated ones, falling back to the journal when there are no log files.
+// The lines are read one at a time, the rotated logs can be large.
+func readAuthLog(since time.Time, fn func(line string)) {
+    var files []string
+    for _, pattern := range []string{"/var/log/secure*", "/var/log/auth.log*"} {
+        matches, _ := filepath.Glob(pattern)
+        files = append(files, matches...)
+    }
+
+    if len(files) == 0 {
+        cmd := exec.Command("journalctl", "_COMM=sshd", "--since", since.Format("2006-01-02 15:04:05"), "-o", "short-iso", "--no-pager")
+        out, err := cmd.StdoutPipe()
+        if err != nil {
+            common.LogError("Error reading the journal: " + err.Error())
+            return
+        }
+
+        if err := cmd.Start(); err != nil {
+            common.LogError("Error reading the journal: " + err.Error())
+            return
+        }
+
+        scanLines("the journal", out, fn)
+
+        if err := cmd.Wait(); err != nil {
+            common.LogError("Error reading the journal: " + err.Error())
+        }
+        return
+    }
+
+    for _, file := range files {
+        f, err := os.Open(file)
+        if err != nil {
+            common.LogError("Error opening " + file + ": " + err.Error())
+            continue
+        }
+
+        if strings.HasSuffix(file, ".gz") {
+            gz, err := gzip.NewReader(f)
+            if err != nil {
+                common.LogError("Error reading " + file + ": " + err.Error())
+                f.Close()
+                continue
+            }
+            scanLines(file, gz, fn)
+            gz.Close()
+        } else {
+            scanLines(file, f, fn)
+        }
+
+        f.Close()
+    }
+}
+
+// scanLines calls fn with every line read from r
+func scanLines(name string, r io.Reader, fn func(line string)) {
+    scanner := bufio.NewScanner(r)
+    for scanner.Scan() {
+        fn(scanner.Text())
+    }
+
+    if err := scanner.Err(); err != nil {
+        common.LogError("Error reading " + name + ": " + err.Error())
+    }
+}
+
+type acceptedLogin struct {
+    method string
+    user string
+    ip string
+    fingerprint string
+}
+
+// loginParser reconstructs the session events since the given time from
+// the sshd log lines, using the Accepted line of the same sshd process for
+// the remote IP and the login method
+type loginParser struct {
+    since time.Time
+    acceptedByPid map[string]acceptedLogin
+    logins []LoginInfoOutput
+}
+
+func newLoginParser(since time.Time) *loginParser {
+    return &loginParser{since: since, acceptedByPid: make(map[string]acceptedLogin)}
+}
+
+// parse adds the session event of line to the logins, if it is one
+func (p *loginParser) parse(line string) {
+    match := sshdLine.FindStringSubmatch(line)
+    if match == nil {
+        return
+    }
+
+    date, err := parseLogDate(match[1])
+    if err != nil {
+        return
+    }
+
+    pid := match[2]
+
+    if acceptedMatch := acceptedLine.FindStringSubmatch(match[3]); acceptedMatch != nil {
+        p.acceptedByPid[pid] = acceptedLogin{method: acceptedMatch[1], user: acceptedMatch[2], ip: acceptedMatch[3], fingerprint: acceptedMatch[4]}
+        return
+    }
+
+    sessionMatch := sessionLine.FindStringSubmatch(match[3])
+    if sessionMatch == nil || date.Before(p.since) {
+        return
+    }
+
+    login := LoginInfoOutput{
+        PamUser: sessionMatch[2],
+        Username: sessionMatch[2],
+        Server: sessionMatch[2] + "@" + common.Config.Identifier,
+        Date: date.Format("02.01.2006 15:04:05"),
+        Type: "open_session",
+        LoginMethod: "password",
+        Ppid: pid,
+    }
+
+    if sessionMatch[1] == "closed" {
+        login.Type = "close_session"
+    }
+
+    if acc, ok := p.acceptedByPid[pid]; ok {
+        login.RemoteIp = acc.ip
+        login.Fingerprint = acc.fingerprint
+        if acc.method == "publickey" {
+            login.LoginMethod = "ssh-key"
+        }
+    }
+
+    p.logins = append(p.logins, login)
+}
+
+// excluded reports whether the login matches the configured exclusions
+func excluded(login LoginInfoOutput) bool {
+    user := strings.Split(login.Username, "@")[0]
+
+    for _, excludeUser := range SSHNotifierConfig.Exclude.Users {
+        if user == excludeUser {
+            return true
+        }
+    }
+
+    for _, excludeIp := range SSHNotifierConfig.Exclude.IPs {
+        if login.RemoteIp != "" && login.RemoteIp == excludeIp {
+            return true
+        }
+    }
+
+    for _, excludeDomain := range SSHNotifierConfig.Exclude.Domains {
+        if strings.Contains(login.Username, excludeDomain) {
+            return true
+        }
+    }
+
+    return false
+}
+
+// Backfill posts the logins found in the auth logs since the given time
+// that weren't posted yet, marked as backfilled. No alarms are sent.
+func Backfill(since time.Time, dryRun bool) {
+    records := loadLoginRecords()
+    posted := 0
+    skipped := 0
+
+    parser := newLoginParser(since)
+    readAuthLog(since, parser.parse)
+
+    for _, login := range parser.logins {
+        date, _ := time.ParseInLocation("02.01.2006 15:04:05", login.Date, time.Local)
+
+        if excluded(login) || loginRecorded(records, login.Ppid, login.Type, date) {
+            skipped++
+            continue
+        }
+
+        if dryRun {
+            fmt.Println(login.Date + " " + login.Type + " " + login.Username + "@" + login.RemoteIp + " (" + login.Ppid + ")")
+            posted++
+            continue
+        }
+
+        dbReq := newDatabaseRequest(login)
+        dbReq.Date = "'" + date.Format("2006-01-02 15:04:05") + "'"
+        dbReq.Backfilled = "'true'"
+
+        if err := postLogin(dbReq); err != nil {
+            common.LogError("Error posting the login of " + login.Username + " at " + login.Date + ": " + err.Error())
+            continue
+        }
+
+        recordLogin(login.Ppid, login.Type, date)
+        posted++
+    }
+
+    if dryRun {
+        fmt.Println(fmt.Sprint(posted) + " logins would be posted, " + fmt.Sprint(skipped) + " are already posted or excluded")
+    } else {
+        fmt.Println(fmt.Sprint(posted) + " logins posted, " + fmt.Sprint(skipped) + " were already posted or excluded")
+    }
+}
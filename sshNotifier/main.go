@@ -6,7 +6,6 @@ import (
 	"io/fs"
     "bufio"
 	"bytes"
-	"slices"
 	"os/exec"
 	"strconv"
     "strings"
@@ -26,6 +25,9 @@ var SSHNotifierConfig struct {
     	Users []string
 	}
 
+    // Logins that are recorded to the database without a notification
+    Allow []AllowRule
+
     Server struct {
         Os_Type string
         Address string
@@ -33,6 +35,7 @@ var SSHNotifierConfig struct {
 
     Ssh_Post_Url string
     Ssh_Post_Url_Backup string
+    Tls common.TlsClient
 
     Webhook struct {
         Modify_Stream bool
@@ -60,6 +63,8 @@ type DatabaseRequest struct {
 	Host string `json:"host"`
 	ConnectedFrom string `json:"connected_from"`
 	LoginType string `json:"login_type"`
+	Date string `json:"date,omitempty"`
+	Backfilled string `json:"backfilled,omitempty"`
 }
 
 func Grep(pattern string, contents string) string {
@@ -288,8 +293,16 @@ func PostToDb(postUrl string, dbReq DatabaseRequest) error {
 
 	req.Header.Set("Content-Type", "application/json")
 	
-	client := &http.Client{
-		Timeout: time.Second,
+	transport, err := common.TLSTransport(SSHNotifierConfig.Tls)
+	if err != nil {
+		return err
+	}
+
+	var client *http.Client
+	if transport != nil {
+		client = common.HTTPClient(time.Second, transport)
+	} else {
+		client = common.HTTPClient(time.Second, nil)
 	}
 	resp, err := client.Do(req)
 	if err != nil {
@@ -307,6 +320,9 @@ func PostToDb(postUrl string, dbReq DatabaseRequest) error {
 func NotifyAndSave(loginInfo LoginInfoOutput) {
 	var message string
 
+	// Before the key comment is cut at the @
+	allowed := loginAllowed(loginInfo)
+
 	if loginInfo.Type == "open_session" {
 		message = "[ " + common.Config.Identifier + " ] " + "[ :green: Login ] { " + loginInfo.Username + "@" + loginInfo.RemoteIp + " } >> { " + SSHNotifierConfig.Server.Address + " - " + loginInfo.Ppid + " }"
 	} else {
@@ -317,9 +333,14 @@ func NotifyAndSave(loginInfo LoginInfoOutput) {
 		loginInfo.Username = strings.Split(loginInfo.Username, "@")[0]
 	}
 
-	fileList := slices.Concat(listFiles("/tmp/mono"), listFiles("/tmp/mono.sh"))
+	fileList := listFiles("/tmp/mono.sh")
+	for _, component := range common.InstalledComponents() {
+		fileList = append(fileList, listFiles(common.TmpBaseDir + component)...)
+	}
 
-	if len(fileList) == 0 {
+	if allowed {
+		common.Println("Login of " + loginInfo.PamUser + " from " + loginInfo.RemoteIp + " is allowed, not notifying")
+	} else if len(fileList) == 0 {
         if !SSHNotifierConfig.Webhook.Modify_Stream {
             common.Alarm(message, "", "", false)
         } else {
@@ -329,6 +350,16 @@ func NotifyAndSave(loginInfo LoginInfoOutput) {
 		common.Alarm(message, "", "", false)
 	}
 
+	err := postLogin(newDatabaseRequest(loginInfo))
+	if err != nil {
+		common.LogError("Error posting to db: " + err.Error())
+		return
+	}
+
+	recordLogin(loginInfo.Ppid, loginInfo.Type, time.Now())
+}
+
+func newDatabaseRequest(loginInfo LoginInfoOutput) DatabaseRequest {
 	var dbReq DatabaseRequest
 
 	dbReq.Ppid = "'" + loginInfo.Ppid + "'"
@@ -339,13 +370,16 @@ func NotifyAndSave(loginInfo LoginInfoOutput) {
 	dbReq.ConnectedFrom = "'" + loginInfo.RemoteIp + "'"
 	dbReq.LoginType = "'" + loginInfo.LoginMethod + "'"
 
+	return dbReq
+}
+
+// postLogin posts the login to the database, falling back to the backup URL
+func postLogin(dbReq DatabaseRequest) error {
 	err := PostToDb(SSHNotifierConfig.Ssh_Post_Url, dbReq)
 	if err != nil {
 		err = PostToDb(SSHNotifierConfig.Ssh_Post_Url_Backup, dbReq)
-		if err != nil {
-			common.LogError("Error posting to db: " + err.Error())
-		}
 	}
+	return err
 }
         
 func Main(cmd *cobra.Command, args []string) {
@@ -107,7 +107,7 @@ func LogChecker(file string, lastRunStr string, currentTimeStr string, typesToCh
 func Main(cmd *cobra.Command, args []string) {
 	version := "0.1.0"
 	common.ScriptName = "traefikHealth"
-	common.TmpDir = common.TmpDir + "traefikHealth"
+	common.TmpDir = common.TmpBaseDir + "traefikHealth"
 	common.Init()
 
 	if common.ConfExists("traefik") {
@@ -122,7 +122,7 @@ func Main(cmd *cobra.Command, args []string) {
 		TraefikHealthConfig.Ports_To_Check = []uint32{80, 443}
 	}
 	
-	fmt.Println("Traefik Health - v" + version + " - " + time.Now().Format("2006-01-02 15:04:05"))
+	common.Println("Traefik Health - v" + version + " - " + common.FormatTime(time.Now()))
 
 	common.SplitSection("Service")
 
@@ -1,11 +1,10 @@
 package wppconnectHealth
 
 import (
-	"fmt"
 	"github.com/monobilisim/monokit/common"
 	"github.com/spf13/cobra"
 	"net/http"
-	"os"
+	"errors"
     "encoding/json"
 	"time"
 )
@@ -17,20 +16,18 @@ var Config struct {
     }
 }
 
-func GetStatus(session string, token string) string {
+func GetStatus(session string, token string) (string, error) {
     // Authorization: Bearer token
-    client := &http.Client{}
+    client := common.HTTPClient(0, nil)
     req, err := http.NewRequest("GET", Config.Wpp.Url + "/api/" + session + "/check-connection-session", nil)
     if err != nil {
-        common.LogError("Error while checking connection: " + err.Error())
-        os.Exit(1)
+        return "", errors.New("Error while checking connection: " + err.Error())
     }
 
     req.Header.Add("Authorization", "Bearer " + token)
     resp, err := client.Do(req)
     if err != nil {
-        common.LogError("Error while checking connection: " + err.Error())
-        os.Exit(1)
+        return "", errors.New("Error while checking connection: " + err.Error())
     }
 
     defer resp.Body.Close()
@@ -39,24 +36,22 @@ func GetStatus(session string, token string) string {
     json.NewDecoder(resp.Body).Decode(&result)
     status := result["message"].(string)
 
-    return status
+    return status, nil
 }
 
-func GetContactName(session string, token string) string {
+func GetContactName(session string, token string) (string, error) {
     // Authorization: Bearer
-    client := &http.Client{}
+    client := common.HTTPClient(0, nil)
     req, err := http.NewRequest("GET", Config.Wpp.Url + "/api/" + session + "/contact/" + session, nil)
 
     if err != nil {
-        common.LogError("Error while getting contact name: " + err.Error())
-        os.Exit(1)
+        return "", errors.New("Error while getting contact name: " + err.Error())
     }
 
     req.Header.Add("Authorization", "Bearer " + token)
     resp, err := client.Do(req)
     if err != nil {
-        common.LogError("Error while getting contact name: " + err.Error())
-        os.Exit(1)
+        return "", errors.New("Error while getting contact name: " + err.Error())
     }
 
     defer resp.Body.Close()
@@ -81,24 +76,22 @@ func GetContactName(session string, token string) string {
         }
     }
 
-    return contactName
+    return contactName, nil
 }
 
 
 
-func GetToken(session string) string {
-    client := &http.Client{}
+func GetToken(session string) (string, error) {
+    client := common.HTTPClient(0, nil)
     req, err := http.NewRequest("POST", Config.Wpp.Url + "/api/" + session + "/" + Config.Wpp.Secret + "/generate-token", nil)
     if err != nil {
-        common.LogError("Error while generating token: " + err.Error())
-        os.Exit(1)
+        return "", errors.New("Error while generating token: " + err.Error())
     }
 
     req.Header.Add("Content-Type", "application/json")
     resp, err := client.Do(req)
     if err != nil {
-        common.LogError("Error while generating token: " + err.Error())
-        os.Exit(1)
+        return "", errors.New("Error while generating token: " + err.Error())
     }
 
     defer resp.Body.Close()
@@ -106,23 +99,23 @@ func GetToken(session string) string {
     var token map[string]interface{}
     json.NewDecoder(resp.Body).Decode(&token)
     tokenStr := token["token"].(string)
-    return tokenStr
+    return tokenStr, nil
 }
 
-func WppCheck() {
+// WppCheck returns an error when the sessions couldn't be checked, the
+// alarms already queued are still delivered by the caller
+func WppCheck() error {
     // GET request to Config.Wpp.Url + "/api/" + Config.Wpp.Secret + "/show-all-sessions"
     url := Config.Wpp.Url + "/api/" + Config.Wpp.Secret + "/show-all-sessions"
-    resp, err := http.Get(url)
+    resp, err := common.HTTPClient(0, nil).Get(url)
     if err != nil {
-        common.LogError("Error while getting sessions: " + err.Error())
-        os.Exit(1)
+        return errors.New("Error while getting sessions: " + err.Error())
     }
     defer resp.Body.Close()
 
     // Check if the response is 200
     if resp.StatusCode != 200 {
-        common.LogError("Error while getting sessions: Status " + resp.Status)
-        os.Exit(1)
+        return errors.New("Error while getting sessions: Status " + resp.Status)
     }
 
     // Read the response
@@ -132,18 +125,31 @@ func WppCheck() {
     sessions := result["response"].([]interface{})
 
     for _, session := range sessions {
-        token := GetToken(session.(string))
-        status := GetStatus(session.(string), token)
-        contactName := GetContactName(session.(string), token)
+        token, err := GetToken(session.(string))
+        if err != nil {
+            return err
+        }
+
+        status, err := GetStatus(session.(string), token)
+        if err != nil {
+            return err
+        }
+
+        contactName, err := GetContactName(session.(string), token)
+        if err != nil {
+            return err
+        }
 
         if status == "Connected" {
-            fmt.Println(common.Blue + contactName + ", Session " + session.(string) + " " + common.Green + status + common.Reset)
+            common.Println(common.Blue + contactName + ", Session " + session.(string) + " " + common.Green + status + common.Reset)
             common.AlarmCheckUp(session.(string), "Session " + session.(string) + ", named '" + contactName + "', is now " + status, false)
         } else {
-            fmt.Println(common.Blue + contactName + ", Session " + session.(string) + " " + common.Fail + status + common.Reset)
+            common.Println(common.Blue + contactName + ", Session " + session.(string) + " " + common.Fail + status + common.Reset)
             common.AlarmCheckDown(session.(string), "Session " + session.(string) + ", named '" + contactName + "', is " + status, false)
         }
     }
+
+    return nil
 }
 
 
@@ -151,12 +157,15 @@ func WppCheck() {
 func Main(cmd *cobra.Command, args []string) {
 	version := "2.0.0"
 	common.ScriptName = "wppconnectHealth"
-	common.TmpDir = common.TmpDir + "Health"
+	common.TmpDir = common.TmpBaseDir + "wppconnectHealth"
 	common.Init()
     common.ConfInit("wppconnect", &Config)
 
-	fmt.Println("WPPConnect Health REWRITE - v" + version + " - " + time.Now().Format("2006-01-02 15:04:05") + "\n")
+	common.Println("WPPConnect Health REWRITE - v" + version + " - " + common.FormatTime(time.Now()) + "\n")
     
-    WppCheck()
+    if err := WppCheck(); err != nil {
+        common.LogError(err.Error())
+        common.SetExitCode(common.ExitCheckFailed)
+    }
 
 }
@@ -0,0 +1,150 @@
+//go:build linux
+package zimbraHealth
+
+import (
+    "fmt"
+    "sort"
+    "time"
+    "strings"
+    "github.com/monobilisim/monokit/common"
+    issues "github.com/monobilisim/monokit/common/redmine/issues"
+)
+
+// accountHistoryMaxAge is how long the daily account counts are kept
+const accountHistoryMaxAge = 400 * 24 * time.Hour
+
+// accountGrowthWindow is the period the growth is reported for
+const accountGrowthWindow = 30 * 24 * time.Hour
+
+type DomainAccounts struct {
+    Domain string
+    Accounts int
+    Growth int
+    SeatCap int
+}
+
+// countAccounts tallies the accounts listed by zmprov gaa per domain
+func countAccounts() (map[string]int, error) {
+    out, err := ExecZimbraCommand("zmprov -l gaa")
+    if err != nil {
+        return nil, err
+    }
+
+    domains := make(map[string]int)
+
+    for _, line := range strings.Split(out, "\n") {
+        _, domain, found := strings.Cut(strings.TrimSpace(line), "@")
+        if !found || domain == "" {
+            continue
+        }
+        domains[strings.ToLower(domain)]++
+    }
+
+    return domains, nil
+}
+
+// accountGrowth stores the count of domain and returns its change since
+// the oldest sample within the growth window
+func accountGrowth(domain string, count int) int {
+    series := common.Series{Name: "accounts_" + domain, MaxSamples: 1000, MaxAge: accountHistoryMaxAge}
+
+    if err := series.Append(float64(count)); err != nil {
+        common.LogError("Error writing the account history of " + domain + ": " + err.Error())
+    }
+
+    samples := series.Since(time.Now().Add(-accountGrowthWindow))
+    if len(samples) == 0 {
+        return 0
+    }
+
+    return count - int(samples[0].Value)
+}
+
+func domainSeatCap(domain string) int {
+    for _, seatCap := range MailHealthConfig.Zimbra.Accounts.Domain_Seat_Caps {
+        if strings.EqualFold(seatCap.Domain, domain) {
+            return seatCap.Seats
+        }
+    }
+    return 0
+}
+
+// seatAlarm alarms when count reaches Warn_Percent of a seat cap
+func seatAlarm(service string, name string, count int, seatCap int, warnPercent float64) {
+    if seatCap <= 0 {
+        return
+    }
+
+    usage := fmt.Sprintf("%d/%d seats", count, seatCap)
+
+    if float64(count) >= float64(seatCap) * warnPercent / 100 {
+        common.AlarmCheckDown(service, name + " is close to its seat cap - " + usage, false)
+        issues.CheckDown(service, common.Config.Identifier + " için " + name + " lisans kapasitesine yaklaştı", "Hesap sayısı: " + usage, false, 0)
+    } else {
+        common.AlarmCheckUp(service, name + " is no longer close to its seat cap - " + usage, false)
+        issues.CheckUp(service, name + " hesap sayısı lisans kapasitesinin altına düştü: " + usage)
+    }
+}
+
+// CheckAccounts counts the accounts of each domain once a day at
+// Accounts.Schedule, shows their growth over the last 30 days and alarms
+// when a domain, or all of them, reach Warn_Percent of their seat cap.
+func CheckAccounts() []DomainAccounts {
+    config := MailHealthConfig.Zimbra.Accounts
+
+    schedule := config.Schedule
+    if schedule == "" {
+        schedule = "02:00"
+    }
+
+    warnPercent := config.Warn_Percent
+    if warnPercent == 0 {
+        warnPercent = 90
+    }
+
+    if !common.ScheduleDue("account_count", schedule) {
+        return nil
+    }
+
+    common.SplitSection("Accounts:")
+
+    counts, err := countAccounts()
+    if err != nil {
+        common.LogError("Error counting the accounts: " + err.Error())
+        return nil
+    }
+
+    common.ScheduleDone("account_count")
+
+    var domains []DomainAccounts
+    total := 0
+
+    for domain, count := range counts {
+        total += count
+        domains = append(domains, DomainAccounts{
+            Domain: domain,
+            Accounts: count,
+            Growth: accountGrowth(domain, count),
+            SeatCap: domainSeatCap(domain),
+        })
+    }
+
+    sort.Slice(domains, func(i, k int) bool {
+        return domains[i].Domain < domains[k].Domain
+    })
+
+    for _, domain := range domains {
+        value := fmt.Sprintf("%d accounts, %+d in 30 days", domain.Accounts, domain.Growth)
+        if domain.SeatCap > 0 {
+            value += fmt.Sprintf(", %d seats", domain.SeatCap)
+        }
+
+        common.PrettyPrintStr(domain.Domain, domain.SeatCap == 0 || float64(domain.Accounts) < float64(domain.SeatCap) * warnPercent / 100, value)
+        seatAlarm("seats_" + domain.Domain, domain.Domain, domain.Accounts, domain.SeatCap, warnPercent)
+    }
+
+    common.PrettyPrintStr("Total", config.Seat_Cap == 0 || float64(total) < float64(config.Seat_Cap) * warnPercent / 100, fmt.Sprintf("%d accounts", total))
+    seatAlarm("seats_total", "Zimbra", total, config.Seat_Cap, warnPercent)
+
+    return domains
+}
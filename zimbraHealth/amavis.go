@@ -0,0 +1,145 @@
+//go:build linux
+package zimbraHealth
+
+import (
+    "os"
+    "fmt"
+    "errors"
+    "regexp"
+    "context"
+    "strconv"
+    "strings"
+    "github.com/shirou/gopsutil/v4/process"
+    "github.com/monobilisim/monokit/common"
+    issues "github.com/monobilisim/monokit/common/redmine/issues"
+)
+
+type AmavisInfo struct {
+    Running bool
+    Children int
+    Busy int
+    MaxChildren int
+    Backlog int
+    Error string
+}
+
+// amavisMaxChildren reads $max_servers from amavisd.conf, 10 is the
+// default of Zimbra
+func amavisMaxChildren() int {
+    conf, err := os.ReadFile(zimbraPath + "/conf/amavisd.conf")
+    if err != nil {
+        return 10
+    }
+
+    match := regexp.MustCompile(`(?m)^\s*\$max_servers\s*=\s*(\d+)`).FindSubmatch(conf)
+    if match == nil {
+        return 10
+    }
+
+    maxServers, err := strconv.Atoi(string(match[1]))
+    if err != nil || maxServers == 0 {
+        return 10
+    }
+
+    return maxServers
+}
+
+// amavisChildren counts the amavisd child processes from their titles, eg.
+// "amavisd (ch3-avail)" is idle and "amavisd (ch3-12345-01)" is busy
+func amavisChildren() (int, int) {
+    procs, _ := process.Processes()
+    children := 0
+    busy := 0
+
+    for _, proc := range procs {
+        cmdline, err := proc.Cmdline()
+        if err != nil || !strings.HasPrefix(cmdline, "amavisd (") || strings.HasPrefix(cmdline, "amavisd (master)") {
+            continue
+        }
+
+        children++
+
+        if !strings.HasPrefix(cmdline, "amavisd (virgin") && !strings.Contains(cmdline, "-avail)") {
+            busy++
+        }
+    }
+
+    return children, busy
+}
+
+// amavisBacklog counts the queued messages deferred because amavis didn't
+// accept them, Zimbra hands the mail to it on port 10024 and 10032
+func amavisBacklog() int {
+    out, _, err := common.Runner.Run(context.Background(), zimbraPath + "/common/sbin/mailq")
+    // A truncated queue still gives a lower bound of the backlog
+    if common.OutputTruncated(err) {
+        err = errors.Unwrap(err)
+    }
+    if err != nil {
+        return 0
+    }
+
+    return len(regexp.MustCompile(`\]:100(24|32)\b`).FindAllString(out, -1))
+}
+
+// CheckAmavis alarms when amavis is not running, all of its children are
+// busy or too many messages are waiting for it.
+func CheckAmavis() AmavisInfo {
+    var info AmavisInfo
+
+    backlogLimit := MailHealthConfig.Zimbra.Amavis.Backlog_Limit
+    if backlogLimit == 0 {
+        backlogLimit = 50
+    }
+
+    _, err := ExecZimbraCommand("zmamavisdctl status")
+    info.Running = err == nil
+
+    // zmamavisdctl couldn't be run at all, amavis may well be running
+    var cmdErr *ZimbraCmdError
+    if errors.As(err, &cmdErr) && cmdErr.Kind != ZimbraCmdNonZeroExit {
+        info.Error = err.Error()
+        common.PrintCheckFailed("Amavis", info.Error)
+        return info
+    }
+
+    if !info.Running {
+        common.PrettyPrintStr("Amavis", false, "running")
+        common.AlarmCheckDown("amavis", "Amavis is not running: " + err.Error(), false)
+        return info
+    }
+
+    common.PrettyPrintStr("Amavis", true, "running")
+    common.AlarmCheckUp("amavis", "Amavis is running again", false)
+
+    info.MaxChildren = amavisMaxChildren()
+    info.Children, info.Busy = amavisChildren()
+    info.Backlog = amavisBacklog()
+
+    children := fmt.Sprint(info.Busy) + "/" + fmt.Sprint(info.MaxChildren) + " busy"
+    backlog := fmt.Sprint(info.Backlog) + "/" + fmt.Sprint(backlogLimit)
+
+    saturated := info.Busy >= info.MaxChildren
+
+    if saturated {
+        common.PrettyPrintStr("Amavis children", false, "available (" + children + ")")
+    } else {
+        common.PrettyPrintStr("Amavis children", true, "available (" + children + ")")
+    }
+
+    if info.Backlog > backlogLimit {
+        common.PrettyPrintStr("Amavis backlog", false, "acceptable (" + backlog + ")")
+    } else {
+        common.PrettyPrintStr("Amavis backlog", true, "acceptable (" + backlog + ")")
+    }
+
+    if saturated || info.Backlog > backlogLimit {
+        common.AlarmCheckDown("amavis_saturated", "Amavis is saturated, " + children + " children, " + backlog + " messages waiting for it", false)
+        issues.CheckDown("amavis_saturated", common.Config.Identifier + " için Amavis kapasitesi doldu", "Meşgul çocuk süreç: " + children + "\nAmavis bekleyen mesaj: " + backlog, false, 0)
+    } else {
+        common.AlarmCheckUp("amavis_saturated", "Amavis is no longer saturated, " + children + " children, " + backlog + " messages waiting for it", false)
+        issues.CheckUp("amavis_saturated", "Amavis kapasitesi normale döndü, meşgul çocuk süreç: " + children)
+    }
+
+    return info
+}
@@ -0,0 +1,94 @@
+//go:build linux
+package zimbraHealth
+
+import (
+    "os"
+    "fmt"
+    "time"
+    "github.com/monobilisim/monokit/common"
+    issues "github.com/monobilisim/monokit/common/redmine/issues"
+)
+
+type BackupInfo struct {
+    Path string
+    Latest string
+    LastBackup time.Time
+    AgeHours float64
+    Error string
+}
+
+// latestBackup returns the most recently modified entry directly under
+// path or its sessions directory, where zmbackup keeps one directory per
+// backup. The backup tree itself is not walked as it can be huge.
+func latestBackup(path string) (BackupInfo, error) {
+    info := BackupInfo{Path: path}
+
+    for _, dir := range []string{path, path + "/sessions"} {
+        entries, err := os.ReadDir(dir)
+        if err != nil {
+            if dir == path {
+                return info, err
+            }
+            continue
+        }
+
+        for _, entry := range entries {
+            entryInfo, err := entry.Info()
+            if err != nil {
+                continue
+            }
+
+            if entryInfo.ModTime().After(info.LastBackup) {
+                info.LastBackup = entryInfo.ModTime()
+                info.Latest = dir + "/" + entry.Name()
+            }
+        }
+    }
+
+    if info.LastBackup.IsZero() {
+        return info, fmt.Errorf("no backups found in %s", path)
+    }
+
+    info.AgeHours = time.Since(info.LastBackup).Hours()
+
+    return info, nil
+}
+
+// CheckBackup alarms and opens a Redmine issue when the latest backup is
+// older than Max_Hours.
+func CheckBackup() (BackupInfo, error) {
+    config := MailHealthConfig.Zimbra.Backup
+
+    path := config.Path
+    if path == "" {
+        path = zimbraPath + "/backup"
+    }
+
+    maxHours := config.Max_Hours
+    if maxHours == 0 {
+        maxHours = 26
+    }
+
+    info, err := latestBackup(path)
+    if err != nil {
+        info.Error = err.Error()
+        common.PrettyPrintStr("Backup", false, "found")
+        common.AlarmCheckDown("backup", "Couldn't find the latest backup: " + err.Error(), false)
+        issues.CheckDown("backup", common.Config.Identifier + " için Zimbra yedeği bulunamadı", "Yedek dizini: " + path + "\n" + err.Error(), false, 0)
+        return info, err
+    }
+
+    lastBackup := common.FormatTime(info.LastBackup)
+
+    if info.AgeHours > maxHours {
+        common.PrettyPrintStr("Latest backup", false, "recent (" + lastBackup + ", " + common.HumanizeDuration(time.Since(info.LastBackup)) + " ago)")
+        common.AlarmCheckDown("backup", "The latest backup is " + common.HumanizeDuration(time.Since(info.LastBackup)) + " old (" + info.Latest + ")", false)
+        issues.CheckDown("backup", common.Config.Identifier + " için Zimbra yedeği güncel değil", "Son yedek: " + info.Latest + " (" + lastBackup + ")", false, 0)
+    } else {
+        common.PrettyPrintStr("Latest backup", true, "recent (" + lastBackup + ", " + common.HumanizeDuration(time.Since(info.LastBackup)) + " ago)")
+        common.AlarmCheckUp("backup", "Backups are recent again, the latest is from " + lastBackup, false)
+        issues.CheckUp("backup", "Yedekler tekrar güncel, son yedek: " + lastBackup)
+    }
+
+    return info, nil
+}
@@ -0,0 +1,45 @@
+//go:build linux
+package zimbraHealth
+
+import (
+    "strings"
+    "github.com/monobilisim/monokit/common"
+    issues "github.com/monobilisim/monokit/common/redmine/issues"
+)
+
+// CheckCacheHealth alarms when the caches couldn't be saved or loaded for
+// Cache_Failure.Confirm_After runs. The checks relying on them are then
+// redone on every run, eg. the account history is lost, without any other
+// sign of it.
+func CheckCacheHealth() {
+    config := MailHealthConfig.Zimbra.Cache_Failure
+
+    confirmAfter := config.Confirm_After
+    if confirmAfter.Checks == 0 && confirmAfter.Minutes == 0 {
+        confirmAfter.Checks = 3
+    }
+
+    cacheErrors := common.CacheErrors()
+
+    if len(cacheErrors) == 0 {
+        common.ConfirmDown("cache", false, 0, 0)
+        common.AlarmCheckUp("cache", "The caches can be saved and loaded again", false)
+        if config.Redmine {
+            issues.CheckUp("cache", "Önbellek dosyaları tekrar kaydedilebiliyor.")
+        }
+        return
+    }
+
+    common.SplitSection("Cache:")
+
+    if !common.ConfirmDown("cache", true, confirmAfter.Checks, confirmAfter.Minutes) {
+        common.PrettyPrintStr("Cache", false, "working (waiting to confirm)")
+        return
+    }
+
+    common.PrettyPrintStr("Cache", false, "working")
+    common.AlarmCheckDown("cache", "The caches couldn't be saved or loaded, the cached checks run in full every time. Check the storage of " + common.TmpBaseDir + ": " + strings.Join(cacheErrors, "; "), false)
+    if config.Redmine {
+        issues.CheckDown("cache", common.Config.Identifier + " için monokit önbelleği kaydedilemiyor", "Önbellek hataları:\n" + strings.Join(cacheErrors, "\n"), false, 0)
+    }
+}
@@ -0,0 +1,82 @@
+//go:build linux
+package zimbraHealth
+
+import (
+    "errors"
+    "os/exec"
+    "strconv"
+    "strings"
+)
+
+type ZimbraCmdErrorKind int
+
+const (
+    // The command or zimbra itself is not installed
+    ZimbraCmdNotFound ZimbraCmdErrorKind = iota
+    // The command couldn't be executed as the zimbra user
+    ZimbraCmdPermission
+    // The command ran and reported a problem
+    ZimbraCmdNonZeroExit
+    // Neither the zimbra nor the zextras user exists
+    ZimbraCmdUserNotFound
+)
+
+func (k ZimbraCmdErrorKind) String() string {
+    switch k {
+    case ZimbraCmdNotFound:
+        return "not found"
+    case ZimbraCmdPermission:
+        return "permission denied"
+    case ZimbraCmdUserNotFound:
+        return "zimbra service user not found"
+    default:
+        return "nonzero exit"
+    }
+}
+
+type ZimbraCmdError struct {
+    Command string
+    ExitCode int
+    Stderr string
+    Kind ZimbraCmdErrorKind
+}
+
+func (e *ZimbraCmdError) Error() string {
+    if e.Kind == ZimbraCmdUserNotFound {
+        return "Command failed: zimbra service user not found (tried " + strings.Join(zimbraUsers(), ", ") + "): " + e.Command
+    }
+
+    msg := "Command failed (" + e.Kind.String() + ", exit code " + strconv.Itoa(e.ExitCode) + "): " + e.Command
+    if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+        msg += ": " + stderr
+    }
+    return msg
+}
+
+// newZimbraCmdError classifies the error returned by running command
+func newZimbraCmdError(command string, stderr string, err error) *ZimbraCmdError {
+    cmdErr := &ZimbraCmdError{Command: command, ExitCode: -1, Stderr: stderr, Kind: ZimbraCmdNonZeroExit}
+
+    var exitErr *exec.ExitError
+    if errors.As(err, &exitErr) {
+        cmdErr.ExitCode = exitErr.ExitCode()
+    }
+
+    lowerStderr := strings.ToLower(stderr)
+
+    switch {
+    case errors.Is(err, exec.ErrNotFound) || cmdErr.ExitCode == 127 || strings.Contains(lowerStderr, "no such file") || strings.Contains(lowerStderr, "does not exist"):
+        cmdErr.Kind = ZimbraCmdNotFound
+    case cmdErr.ExitCode == 126 || strings.Contains(lowerStderr, "permission denied") || strings.Contains(lowerStderr, "authentication failure"):
+        cmdErr.Kind = ZimbraCmdPermission
+    }
+
+    return cmdErr
+}
+
+// zimbraMissing reports whether err means zimbra is not installed, in which
+// case no alarm should be sent for it.
+func zimbraMissing(err error) bool {
+    var cmdErr *ZimbraCmdError
+    return errors.As(err, &cmdErr) && cmdErr.Kind == ZimbraCmdNotFound
+}
@@ -0,0 +1,159 @@
+//go:build linux
+package zimbraHealth
+
+import (
+    "os"
+    "fmt"
+    "time"
+    "errors"
+    "strconv"
+    "strings"
+    "encoding/csv"
+    "github.com/monobilisim/monokit/common"
+    issues "github.com/monobilisim/monokit/common/redmine/issues"
+)
+
+// zmstatMaxAge is how old the last zmstat sample can be, zmstat samples
+// every 30 seconds by default
+const zmstatMaxAge = 10 * time.Minute
+
+type JVMHeapInfo struct {
+    UsedMB float64
+    MaxMB float64
+    UsedPercent float64
+    Sampled time.Time
+    Error string
+}
+
+// mailboxdMaxHeap returns the maximum heap of mailboxd in MB from the
+// mailboxd_java_heap_size local config
+func mailboxdMaxHeap() float64 {
+    out, err := ExecZimbraCommand("zmlocalconfig -m nokey mailboxd_java_heap_size")
+    if err != nil {
+        return 0
+    }
+
+    maxHeap, err := strconv.ParseFloat(strings.TrimSpace(out), 64)
+    if err != nil {
+        return 0
+    }
+
+    return maxHeap
+}
+
+// lastZmstatSample returns the header and the last line of a zmstat CSV
+func lastZmstatSample(path string) (map[string]string, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+
+    defer file.Close()
+
+    reader := csv.NewReader(file)
+    reader.FieldsPerRecord = -1
+    reader.TrimLeadingSpace = true
+
+    records, err := reader.ReadAll()
+    if err != nil {
+        return nil, err
+    }
+
+    if len(records) < 2 {
+        return nil, errors.New("no samples in " + path)
+    }
+
+    header := records[0]
+    last := records[len(records) - 1]
+    sample := make(map[string]string)
+
+    for i, column := range header {
+        if i < len(last) {
+            sample[strings.TrimSpace(column)] = strings.TrimSpace(last[i])
+        }
+    }
+
+    return sample, nil
+}
+
+// mailboxdHeap reads the heap usage of mailboxd from the zmstat samples
+func mailboxdHeap() (JVMHeapInfo, error) {
+    var info JVMHeapInfo
+    path := zimbraPath + "/zmstat/mailboxd.csv"
+
+    stat, err := os.Stat(path)
+    if err != nil {
+        return info, err
+    }
+
+    info.Sampled = stat.ModTime()
+    if time.Since(info.Sampled) > zmstatMaxAge {
+        return info, fmt.Errorf("the last zmstat sample in %s is from %s, is zmstat running?", path, common.FormatTime(info.Sampled))
+    }
+
+    sample, err := lastZmstatSample(path)
+    if err != nil {
+        return info, err
+    }
+
+    used, errUsed := strconv.ParseFloat(sample["heap_used"], 64)
+    free, errFree := strconv.ParseFloat(sample["heap_free"], 64)
+    if errUsed != nil || errFree != nil {
+        return info, errors.New("no heap_used or heap_free columns in " + path)
+    }
+
+    // zmstat reports bytes
+    info.UsedMB = used / 1024 / 1024
+    info.MaxMB = mailboxdMaxHeap()
+    if info.MaxMB == 0 {
+        info.MaxMB = (used + free) / 1024 / 1024
+    }
+
+    if info.MaxMB > 0 {
+        info.UsedPercent = info.UsedMB / info.MaxMB * 100
+    }
+
+    return info, nil
+}
+
+// CheckJVMHeap alarms when the heap usage of mailboxd has been over
+// Jvm_Heap.Limit percent for Jvm_Heap.Confirm_After, mailboxd runs out of
+// memory or spends its time collecting garbage long before the host is out
+// of memory.
+func CheckJVMHeap() (JVMHeapInfo, error) {
+    config := MailHealthConfig.Zimbra.Jvm_Heap
+
+    limit := config.Limit
+    if limit == 0 {
+        limit = 90
+    }
+
+    confirmAfter := config.Confirm_After
+    if confirmAfter.Checks == 0 && confirmAfter.Minutes == 0 {
+        confirmAfter.Checks = 3
+    }
+
+    info, err := mailboxdHeap()
+    if err != nil {
+        info.Error = err.Error()
+        common.PrintCheckFailed("Mailboxd heap", info.Error)
+        return info, err
+    }
+
+    heap := fmt.Sprintf("%.0f/%.0f MB, %.1f%%", info.UsedMB, info.MaxMB, info.UsedPercent)
+
+    if info.UsedPercent <= limit {
+        common.ConfirmDown("jvm_heap", false, 0, 0)
+        common.PrettyPrintStr("Mailboxd heap", true, "acceptable (" + heap + ")")
+        common.AlarmCheckUp("jvm_heap", "Mailboxd heap usage is acceptable again - " + heap, false)
+        issues.CheckUp("jvm_heap", "Mailboxd heap kullanımı normale döndü: " + heap)
+    } else if !common.ConfirmDown("jvm_heap", true, confirmAfter.Checks, confirmAfter.Minutes) {
+        common.PrettyPrintStr("Mailboxd heap", false, "acceptable (" + heap + ", waiting to confirm)")
+    } else {
+        common.PrettyPrintStr("Mailboxd heap", false, "acceptable (" + heap + ")")
+        common.AlarmCheckDown("jvm_heap", "Mailboxd heap usage is above " + fmt.Sprint(limit) + "% - " + heap, false)
+        issues.CheckDown("jvm_heap", common.Config.Identifier + " için mailboxd heap kullanımı yüksek", "Mailboxd heap kullanımı: " + heap + "\nLimit: %" + fmt.Sprint(limit), false, 0)
+    }
+
+    return info, nil
+}
@@ -0,0 +1,150 @@
+//go:build linux
+package zimbraHealth
+
+import (
+    "fmt"
+    "time"
+    "strings"
+    "github.com/monobilisim/monokit/common"
+    issues "github.com/monobilisim/monokit/common/redmine/issues"
+)
+
+// mailboxStatuses are the zimbraAccountStatus values counted, the ones
+// after active are watched for spikes
+var mailboxStatuses = []string{"active", "locked", "lockout", "closed"}
+
+type MailboxCounts struct {
+    Counts map[string]int
+    Increase map[string]int
+}
+
+// countMailboxes counts the accounts with the given status
+func countMailboxes(status string) (int, error) {
+    out, err := ExecZimbraCommand("zmprov -l sa zimbraAccountStatus=" + status)
+    if err != nil {
+        return 0, err
+    }
+
+    count := 0
+    for _, line := range strings.Split(out, "\n") {
+        if strings.Contains(line, "@") {
+            count++
+        }
+    }
+
+    return count, nil
+}
+
+// mailboxCacheVersion is the schema version of the mailbox counts cache
+const mailboxCacheVersion = 1
+
+// mailboxCache holds the latest counts and the baseline the increase is
+// measured from, which is only replaced every Spike_Hours, so a spike stays
+// alarmed until then rather than clearing on the next run
+type mailboxCache struct {
+    Checked time.Time `json:"checked"`
+    Counts map[string]int `json:"counts"`
+    BaselineTime time.Time `json:"baseline_time"`
+    Baseline map[string]int `json:"baseline"`
+}
+
+func mailboxCachePath() string {
+    return common.TmpDir + "/mailboxes.json"
+}
+
+// CheckMailboxes counts the accounts by status every Cache_Minutes and
+// alarms when the locked, locked out or closed ones increase by more than
+// Mailboxes.Spike_Limit within Spike_Hours, which is usually a brute force
+// attack or a compromised account being shut down.
+func CheckMailboxes() MailboxCounts {
+    config := MailHealthConfig.Zimbra.Mailboxes
+    info := MailboxCounts{Counts: make(map[string]int), Increase: make(map[string]int)}
+
+    spikeLimit := config.Spike_Limit
+    if spikeLimit == 0 {
+        spikeLimit = 10
+    }
+
+    spikeHours := config.Spike_Hours
+    if spikeHours == 0 {
+        spikeHours = 24
+    }
+
+    cacheMinutes := config.Cache_Minutes
+    if cacheMinutes == 0 {
+        cacheMinutes = 60
+    }
+
+    var cache mailboxCache
+    common.LoadCache(mailboxCachePath(), mailboxCacheVersion, &cache)
+    if cache.Counts == nil {
+        cache.Counts = make(map[string]int)
+    }
+
+    // zmprov is slow on large installations, the counts are only refreshed
+    // every cacheMinutes. A failed count is retried on the next run.
+    if time.Since(cache.Checked) >= time.Duration(cacheMinutes * float64(time.Minute)) {
+        complete := true
+
+        for _, status := range mailboxStatuses {
+            count, err := countMailboxes(status)
+            if err != nil {
+                common.LogError("Error counting the " + status + " accounts: " + err.Error())
+                complete = false
+                continue
+            }
+            cache.Counts[status] = count
+        }
+
+        if complete {
+            cache.Checked = time.Now()
+        }
+
+        if complete && (cache.Baseline == nil || time.Since(cache.BaselineTime) >= time.Duration(spikeHours * float64(time.Hour))) {
+            cache.Baseline = make(map[string]int)
+            for status, count := range cache.Counts {
+                cache.Baseline[status] = count
+            }
+            cache.BaselineTime = time.Now()
+        }
+
+        if err := common.SaveCache(mailboxCachePath(), mailboxCacheVersion, cache); err != nil {
+            common.LogError("Error saving the mailbox counts: " + err.Error())
+        }
+    }
+
+    var spikes []string
+
+    for _, status := range mailboxStatuses {
+        count, ok := cache.Counts[status]
+        if !ok {
+            continue
+        }
+
+        info.Counts[status] = count
+        if baseline, ok := cache.Baseline[status]; ok {
+            info.Increase[status] = count - baseline
+        }
+
+        value := fmt.Sprintf("%d (%+d)", count, info.Increase[status])
+        name := strings.ToUpper(status[:1]) + status[1:] + " accounts"
+
+        if status != "active" && info.Increase[status] > spikeLimit {
+            spikes = append(spikes, fmt.Sprintf("%s %+d", status, info.Increase[status]))
+            common.PrettyPrintStr(name, false, value)
+        } else {
+            common.PrettyPrintStr(name, true, value)
+        }
+    }
+
+    if len(spikes) > 0 {
+        since := common.FormatTime(cache.BaselineTime)
+        common.AlarmCheckDown("mailbox_status_spike", "Accounts are being locked or closed in bulk since " + since + ": " + strings.Join(spikes, ", "), false)
+        issues.CheckDown("mailbox_status_spike", common.Config.Identifier + " için kilitlenen veya kapatılan hesap sayısı arttı", since + " tarihinden bu yana: " + strings.Join(spikes, ", ") + "\n\nOtomatik bir saldırı olabilir.", false, 0)
+    } else {
+        common.AlarmCheckUp("mailbox_status_spike", "Accounts are no longer being locked or closed in bulk", false)
+        issues.CheckUp("mailbox_status_spike", "Kilitlenen veya kapatılan hesap sayısındaki artış durdu.")
+    }
+
+    return info
+}
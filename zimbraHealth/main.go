@@ -6,15 +6,17 @@ import (
     "os"
     "fmt"
     "time"
-    "bytes"
     "bufio"
+    "errors"
     "regexp"
-    "os/exec"
+    "strconv"
+    "context"
     "strings"
     "net/http"
     "crypto/tls"
     "database/sql"
     "github.com/spf13/cobra"
+    "github.com/sirupsen/logrus"
     _ "github.com/go-sql-driver/mysql"
     "github.com/monobilisim/monokit/common"
     mail "github.com/monobilisim/monokit/common/mail"
@@ -24,33 +26,43 @@ var MailHealthConfig mail.MailHealth
 var MainDB *sql.DB
 var MessageDB *sql.DB
 var zimbraPath string
+var zimbraUser string
 
 func Main(cmd *cobra.Command, args []string) {
     version := "2.0.0"
     common.ScriptName = "zimbraHealth"
-    common.TmpDir = common.TmpDir + "zimbraHealth"
+    common.TmpDir = common.TmpBaseDir + "zimbraHealth"
     common.Init()
     common.ConfInit("mail", &MailHealthConfig)
 
-    fmt.Println("Zimbra Health Check REWRITE - v" + version + " - " + time.Now().Format("2006-01-02 15:04:05"))
+    common.Println("Zimbra Health Check REWRITE - v" + version + " - " + common.FormatTime(time.Now()))
     
     if common.ProcGrep("install.sh") {
-        fmt.Println("Installation is running. Exiting.")
+        common.Println("Installation is running. Exiting.")
         return
     }
     
     common.SplitSection("Access through IP:")
-    CheckIpAccess()
+    if !CheckIpAccess() {
+        common.SetExitCode(common.ExitCheckFailed)
+        return
+    }
 
     common.SplitSection("Zimbra Services:")
-    CheckZimbraServices()
+    healthy := CheckZimbraServices()
+
+    if MailHealthConfig.Zimbra.Mail_Ports.Enabled {
+        common.SplitSection("Mail Ports:")
+        CheckMailPorts()
+    }
 
     common.SplitSection("Zimbra Version:")
     zimbraVer, err := ExecZimbraCommand("zmcontrol -v")
     if err != nil {
         common.LogError("Error getting zimbra version: " + err.Error())
+    } else {
+        common.PrettyPrintStr("Zimbra Version", true, zimbraVer)
     }
-    common.PrettyPrintStr("Zimbra Version", true, zimbraVer)
     
     if MailHealthConfig.Zimbra.Z_Url != "" {
         common.SplitSection("Checking Z-Push:")
@@ -59,15 +71,58 @@ func Main(cmd *cobra.Command, args []string) {
 
     common.SplitSection("Queued Messages:")
     CheckQueuedMessages()
+
+    if MailHealthConfig.Zimbra.Amavis.Enabled {
+        common.SplitSection("Amavis:")
+        CheckAmavis()
+    }
+
+    if MailHealthConfig.Zimbra.Jvm_Heap.Enabled {
+        common.SplitSection("JVM Heap:")
+        CheckJVMHeap()
+    }
+
+    if MailHealthConfig.Zimbra.Accounts.Enabled {
+        CheckAccounts()
+    }
+
+    if MailHealthConfig.Zimbra.Mailboxes.Enabled {
+        common.SplitSection("Mailboxes:")
+        CheckMailboxes()
+    }
+
+    if MailHealthConfig.Zimbra.Backup.Enabled {
+        common.SplitSection("Backup:")
+        CheckBackup()
+    }
+
+    if MailHealthConfig.Bounce_Rate.Enabled {
+        common.SplitSection("Bounce Rate:")
+        mail.CheckBounceRate(MailHealthConfig.Bounce_Rate, "/var/log/zimbra.log")
+    }
+
+    if MailHealthConfig.Tls_Audit.Enabled {
+        common.SplitSection("TLS Audit:")
+        mail.CheckTLSAudit(MailHealthConfig.Tls_Audit)
+    }
     
-    date := time.Now().Format("13:04")
-    if date == "01:00" {
+    if common.ScheduleDue("ssl_check", "01:00") {
         common.SplitSection("SSL Expiration:")
         CheckSSL()
+        common.ScheduleDone("ssl_check")
     }
+
+    Zmfixperms()
+
+    CheckCacheHealth()
+
+    common.SplitSection("Overall Health:")
+    common.PrettyPrintStr("Zimbra", healthy, "healthy")
 }
 
-func CheckIpAccess() {
+// CheckIpAccess returns false when the check couldn't be done, Zimbra is
+// not installed or the nginx template or the external IP is missing.
+func CheckIpAccess() bool {
     var productName string
     var templateFile string
     var certFile string
@@ -78,28 +133,20 @@ func CheckIpAccess() {
     var proxyBlock string
     var output string
 
-    if _, err := os.Stat("/opt/zimbra"); !os.IsNotExist(err) {
-        zimbraPath = "/opt/zimbra"
-        productName = "zimbra"
+    if !detectZimbraProduct() {
+        common.Println("Zimbra not found in opt, aborting.")
+        return false
     }
 
-    if _, err := os.Stat("/opt/zextras"); !os.IsNotExist(err) {
-        zimbraPath = "/opt/zextras"
-        productName = "carbonio"
-    }
-
-    if zimbraPath == "" {
-        fmt.Println("Zimbra not found in opt, aborting.")
-        os.Exit(1)
-    }
+    productName = zimbraProduct
 
     templateFile = zimbraPath + "/conf/nginx/templates/nginx.conf.web.https.default.template"
     certFile = zimbraPath + "/ssl/" + productName + "/server/server.crt"
     keyFile = zimbraPath + "/ssl/" + productName + "/server/server.key"
 
     if _, err := os.Stat(templateFile); os.IsNotExist(err) {
-        fmt.Println("Nginx template file " + templateFile + " not found, aborting.")
-        os.Exit(1)
+        common.Println("Nginx template file " + templateFile + " not found, aborting.")
+        return false
     }
     
 
@@ -113,18 +160,20 @@ func CheckIpAccess() {
 
         ipAddress = strings.TrimSpace(string(file))
     } else {
-        // Get IP ifconfig.co
-        resp, err := http.Get("https://ifconfig.co")
+        // The plain text endpoint, ifconfig.co returns HTML to our User-Agent
+        resp, err := common.HTTPClient(0, nil).Get("https://ifconfig.co/ip")
         
         if err != nil {
-            common.LogError("Error getting external IP: " + err.Error())
+            common.PrintCheckFailed("Access with IP", "couldn't get the external IP: " + err.Error())
+            return false
         }
 
         defer resp.Body.Close()
 
         respBody, err := io.ReadAll(resp.Body)
         if err != nil {
-            common.LogError("Error reading external IP: " + err.Error())
+            common.PrintCheckFailed("Access with IP", "couldn't read the external IP: " + err.Error())
+            return false
         }
 
         ipAddress = strings.TrimSpace(string(respBody))
@@ -137,10 +186,13 @@ func CheckIpAccess() {
     matches := re.FindAllString(ipAddress, -1)
 
     if len(matches) == 0 {
-        fmt.Println("External IP not found, aborting.")
-        os.Exit(1)
+        common.Println("External IP not found, aborting.")
+        return false
     }
 
+    // Only the address, never whatever else came with it
+    ipAddress = matches[0]
+
     regexPattern = fmt.Sprintf(
 	    `(?m)\n?(server\s+?{\n?\s+listen\s+443\s+ssl\s+http2;\n?\s+server_name\n?\s+%s;\n?\s+ssl_certificate\s+%s;\n?\s+ssl_certificate_key\s+%s;\n?\s+location\s+/\s+{\n?\s+return\s+200\s+'%s';\n?\s+}\n?})`,
 		ipAddress,
@@ -176,29 +228,36 @@ func CheckIpAccess() {
         output = strings.ReplaceAll(matches[0], "\x00", "\n")
     }
 
-    if output == "" {
-        fmt.Println("Adding proxy control block in " + templateFile + " file...")
+    if output != "" {
+        common.AlarmCheckUp("nginx_proxy_block", "The proxy control block is in " + templateFile + " again", false)
+    } else if !MailHealthConfig.Zimbra.Manage_Nginx_Template {
+        // The template is owned by configuration management, only report it
+        common.PrettyPrintStr("Proxy control block", false, "present")
+        common.AlarmCheckDown("nginx_proxy_block", "The proxy control block is missing in " + templateFile + ", access through the IP is not blocked", false)
+    } else if common.CollectOnlyMode {
+        common.Println("Collect-only mode, not adding the proxy control block in " + templateFile + " file.")
+    } else {
+        common.Println("Adding proxy control block in " + templateFile + " file...")
         file, err := os.OpenFile(templateFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	    if err != nil {
-		    fmt.Printf("Error opening file: %v\n", err)
-		    return
+		    common.LogError("Error opening file: " + err.Error())
+		    return true
 	    }
 	    defer file.Close()
 
 	    // Write the content of proxyBlock to the file
-	    if _, err := file.WriteString(proxyBlock + "\n"); err != nil {
-		    fmt.Printf("Error writing to file: %v\n", err)
-		    return
+	    _, err = file.WriteString(proxyBlock + "\n")
+	    common.Audit("add proxy control block", templateFile, err)
+	    if err != nil {
+		    common.LogError("Error writing to file: " + err.Error())
+		    return true
 	    }
-        fmt.Println("Proxy control block added to " + templateFile + " file.")
+        common.Println("Proxy control block added to " + templateFile + " file.")
     }
 
-    httpClient := &http.Client{
-        Timeout: 10 * time.Second,
-        Transport: &http.Transport{
-            TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-        },
-    }
+    httpClient := common.HTTPClient(10 * time.Second, &http.Transport{
+        TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+    })
 
     req, err := http.NewRequest("GET", "https://" + ipAddress, nil)
 
@@ -213,70 +272,266 @@ func CheckIpAccess() {
     } else {
         common.PrettyPrintStr("Access with IP", true, "accessible")
     }
+
+    return true
 }
 
-func CheckZimbraServices() {
+type ServiceInfo struct {
+    Host string
+    Name string
+    Status string
+}
+
+// parseZmcontrolStatus parses the output of `zmcontrol status`, which lists
+// the services of each server under a "Host <name>" line. The explanation
+// lines following a stopped service are skipped.
+func parseZmcontrolStatus(status string) []ServiceInfo {
+    var services []ServiceInfo
+    host := ""
+
+    for _, line := range strings.Split(status, "\n") {
+        fields := strings.Fields(line)
+
+        if len(fields) < 2 {
+            continue
+        }
+
+        if fields[0] == "Host" && len(fields) == 2 {
+            host = fields[1]
+            continue
+        }
+
+        serviceStatus := fields[len(fields)-1]
+        if serviceStatus != "Running" && serviceStatus != "Stopped" {
+            continue
+        }
+
+        services = append(services, ServiceInfo{
+            Host: host,
+            Name: strings.Join(fields[:len(fields)-1], " "),
+            Status: serviceStatus,
+        })
+    }
+
+    return services
+}
+
+// zimbraServiceIgnored reports whether service is in zimbra.ignore_services
+func zimbraServiceIgnored(service string) bool {
+    return zimbraServiceListed(MailHealthConfig.Zimbra.Ignore_Services, service)
+}
+
+func zimbraServiceAdvisory(service string) bool {
+    return zimbraServiceListed(MailHealthConfig.Zimbra.Advisory_Services, service)
+}
+
+// zimbraServiceListed reports whether service is in list, the service
+// names are matched case insensitively
+func zimbraServiceListed(list []string, service string) bool {
+    for _, listed := range list {
+        if strings.EqualFold(strings.TrimSpace(listed), service) {
+            return true
+        }
+    }
+    return false
+}
+
+// CheckZimbraServices returns false if a critical service is not running,
+// advisory services are alarmed for but don't affect the result.
+func CheckZimbraServices() bool {
     var zimbraServices []string
-    
-    status, err := ExecZimbraCommand("zmcontrol status")
-    
-    if err != nil {
-        common.LogError("Error getting zimbra status: " + err.Error())
-        return
+    var services []ServiceInfo
+    healthy := true
+
+    if zimbraProduct == productCarbonio && !zimbraToolExists("zmcontrol") {
+        var err error
+        services, err = carbonioServices()
+
+        if err != nil {
+            common.LogError("Error getting carbonio status: " + err.Error())
+            common.AlarmCheckDown("zmcontrol", "Couldn't get the carbonio status: " + err.Error(), false)
+            common.SetExitCode(common.ExitCheckFailed)
+            return false
+        }
+    } else {
+        status, err := ExecZimbraCommand("zmcontrol status")
+
+        if err != nil {
+            common.LogError("Error getting zimbra status: " + err.Error())
+
+            var cmdErr *ZimbraCmdError
+            errors.As(err, &cmdErr)
+
+            // zmcontrol status exits nonzero when a service is not running, the output is still usable
+            if cmdErr == nil || cmdErr.Kind != ZimbraCmdNonZeroExit || status == "" {
+                if !zimbraMissing(err) {
+                    common.AlarmCheckDown("zmcontrol", "Couldn't get the zimbra status: " + err.Error(), false)
+                }
+                common.SetExitCode(common.ExitCheckFailed)
+                return false
+            }
+        }
+
+        services = parseZmcontrolStatus(status)
     }
-    
-    for _, service := range strings.Split(status, "\n")[1:] {
-        svc := strings.Join(strings.Fields(service), " ")
-        svcSplit := strings.Split(svc, " ")
-        
-        if len(svcSplit) < 2 {
+
+    common.AlarmCheckUp("zmcontrol", "Zimbra status is available again", false)
+    common.CheckSucceeded("zmcontrol_status")
+
+    hosts := make(map[string]bool)
+    for _, service := range services {
+        hosts[service.Host] = true
+    }
+    multiHost := len(hosts) > 1
+
+    currentHost := ""
+
+    for _, service := range services {
+        serviceName := service.Name
+        zimbraServices = append(zimbraServices, serviceName)
+
+        // Keep the single host alarm names as they were
+        alarmName := serviceName
+        if multiHost {
+            alarmName = service.Host + " " + serviceName
+
+            if service.Host != currentHost {
+                currentHost = service.Host
+                common.Println(common.Blue + "Host " + currentHost + common.Reset)
+            }
+        }
+
+        if zimbraServiceIgnored(serviceName) {
+            common.Println(common.Blue + serviceName + common.Reset + " is ignored (" + service.Status + ")")
+
+            // Clear the alarm of a service that was down before it was ignored
+            common.ConfirmDown(alarmName, false, 0, 0)
+            common.AlarmCheckUp(alarmName, alarmName + " is ignored now", false)
             continue
         }
-        
-        serviceStatus := svcSplit[len(svcSplit)-1]
-        serviceName := strings.Join(svcSplit[:len(svcSplit)-1], " ")
-        zimbraServices = append(zimbraServices, serviceName)
 
-        if serviceStatus == "Running" {
+        confirmAfter := MailHealthConfig.Zimbra.Confirm_After
+
+        if service.Status == "Running" {
+            common.ConfirmDown(alarmName, false, 0, 0)
             common.PrettyPrintStr(serviceName, true, "Running")
-            common.AlarmCheckUp(serviceName, serviceName + " is now running", false)
+            common.AlarmCheckUp(alarmName, alarmName + " is now running", false)
+        } else if !common.ConfirmDown(alarmName, true, confirmAfter.Checks, confirmAfter.Minutes) {
+            common.PrettyPrintStr(serviceName, false, "Running (waiting to confirm)")
         } else {
             common.PrettyPrintStr(serviceName, false, "Running")
+
+            if zimbraServiceAdvisory(serviceName) {
+                common.AlarmCheckDownAdvisory(alarmName, alarmName + " is not running", false)
+            } else {
+                common.AlarmCheckDown(alarmName, alarmName + " is not running", false)
+                healthy = false
+            }
+        }
+    }
+
+    return healthy
+}
+
+// zimbraUsers returns the possible service users, the one matching the
+// install directory first
+func zimbraUsers() []string {
+    if zimbraPath == "/opt/zextras" {
+        return []string{"zextras", "zimbra"}
+    }
+    return []string{"zimbra", "zextras"}
+}
+
+// zimbraServiceUser returns the user the zimbra commands run as, or an
+// empty string if none of them exists
+func zimbraServiceUser(ctx context.Context) string {
+    if zimbraUser != "" {
+        return zimbraUser
+    }
+
+    for _, user := range zimbraUsers() {
+        if _, _, err := common.Runner.Run(ctx, "id", "-u", user); err == nil {
+            zimbraUser = user
+            break
+        }
+    }
+
+    return zimbraUser
+}
+
+// zimbraReadOnlyCommands are the commands that only read the state, they
+// are retried on failure as a lock on the management layer makes them fail
+// briefly. Mutating commands are never retried.
+var zimbraReadOnlyCommands = []string{"zmcontrol status", "zmcontrol -v", "zmhostname", "zmprov gs ", "zmprov -l gaa", "zmprov -l sa ", "zmamavisdctl status"}
+
+// zimbraCommandRetryDelay is multiplied by the attempt number between retries
+var zimbraCommandRetryDelay = 2 * time.Second
+
+func zimbraReadOnly(command string) bool {
+    for _, readOnly := range zimbraReadOnlyCommands {
+        if command == strings.TrimSpace(readOnly) || strings.HasPrefix(command, readOnly) {
+            return true
         }
     }
+    return false
 }
 
+// ExecZimbraCommand runs command as the zimbra user, read-only commands are
+// retried up to Zimbra.Command_Retries times when they exit nonzero without
+// any output. A command that printed its result, eg. zmcontrol status with
+// a stopped service, has reported a problem rather than failed.
 func ExecZimbraCommand(command string) (string, error) {
-    zimbraUser := "zimbra"
+    retries := 0
+    if zimbraReadOnly(command) {
+        retries = MailHealthConfig.Zimbra.Command_Retries
+    }
 
-    // Check if zimbra user exists
-    cmd := exec.Command("id", "zimbra")
-    err := cmd.Run()
-    if err != nil {
-        zimbraUser = "zextras"
+    out, err := execZimbraCommand(command)
+
+    for attempt := 1; attempt <= retries && err != nil; attempt++ {
+        var cmdErr *ZimbraCmdError
+        if !errors.As(err, &cmdErr) || cmdErr.Kind != ZimbraCmdNonZeroExit || strings.TrimSpace(out) != "" {
+            break
+        }
+
+        logrus.Warn("Retrying '" + command + "' (" + strconv.Itoa(attempt) + "/" + strconv.Itoa(retries) + "): " + err.Error())
+        time.Sleep(time.Duration(attempt) * zimbraCommandRetryDelay)
+
+        out, err = execZimbraCommand(command)
+    }
+
+    return out, err
+}
+
+func execZimbraCommand(command string) (string, error) {
+    ctx := context.Background()
+
+    user := zimbraServiceUser(ctx)
+    if user == "" {
+        return "", &ZimbraCmdError{Command: command, ExitCode: -1, Kind: ZimbraCmdUserNotFound}
     }
 
     // Execute command
-    cmd := exec.Command("/bin/su", zimbraUser, "-c", zimbraPath + "/bin/" + command)
-    
-    var out bytes.Buffer
-	cmd.Stdout = &out
-    cmd.Stderr = os.Stderr
-    cmd.Run()
+    out, stderr, err := common.Runner.Run(ctx, "/bin/su", user, "-c", zimbraCommand(command))
+    fmt.Fprint(os.Stderr, stderr)
 
-    if cmd.ProcessState.ExitCode() != 0 {
-        return "", fmt.Errorf("Command failed: " + command)
+    // Incomplete output is not a result, whether or not the command failed
+    if common.OutputTruncated(err) {
+        return out, err
     }
 
-    return out.String(), nil
+    if err != nil {
+        // The output is still returned, eg. zmcontrol status exits nonzero when a service is stopped
+        return out, newZimbraCmdError(command, stderr, err)
+    }
+
+    return out, nil
 }
 
 func CheckZPush() {
     zpushHeader := false
     
-    client := &http.Client{
-        Timeout: 10 * time.Second,
-    }
+    client := common.HTTPClient(10 * time.Second, nil)
 
     req, err := http.NewRequest("GET", MailHealthConfig.Zimbra.Z_Url, nil)
 
@@ -306,45 +561,61 @@ func CheckZPush() {
     }
 }
 
+// queuedMessages counts the messages listed by mailq, truncated is set when
+// the output was cut at the output limit and the count is a lower bound
+func queuedMessages() (count int, truncated bool, err error) {
+    out, _, err := common.Runner.Run(context.Background(), zimbraPath + "/common/sbin/mailq")
+
+    truncated = common.OutputTruncated(err)
+    if truncated {
+        err = errors.Unwrap(err)
+    }
+
+    if err != nil {
+        return 0, truncated, err
+    }
+
+    // The queue IDs start the lines of the messages
+    re := regexp.MustCompile(`^[A-F0-9]`)
+
+    scanner := bufio.NewScanner(strings.NewReader(out))
+    for scanner.Scan() {
+        if re.MatchString(scanner.Text()) {
+            count++
+        }
+    }
+
+    return count, truncated, scanner.Err()
+}
+
 func CheckQueuedMessages() {
-    cmd := exec.Command(zimbraPath + "/common/sbin/mailq")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-
-	err := cmd.Run()
-	if err != nil {
-		fmt.Println("Error running mailq:", err)
-		return
-	}
-
-	// Regex to match lines starting with A-F or 0-9
-	re := regexp.MustCompile(`^[A-F0-9]`)
-
-	// Count matching lines
-	scanner := bufio.NewScanner(&out)
-	count := 0
-	for scanner.Scan() {
-		line := scanner.Text()
-		if re.MatchString(line) {
-			count++
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		fmt.Println("Error reading mailq output:", err)
-		return
-	}
+    count, truncated, err := queuedMessages()
+    if err != nil {
+        common.LogError("Error running mailq: " + err.Error())
+        return
+    }
 
     common.PrettyPrint("Queued Messages", "", float64(count), false, false, true, float64(MailHealthConfig.Zimbra.Queue_Limit))
+    if truncated {
+        common.PrintCheckFailed("Queued Messages", "the mailq output was truncated, there are at least " + strconv.Itoa(count))
+    }
 
-    if count > MailHealthConfig.Zimbra.Queue_Limit {
+    queueThreshold := common.NewThreshold("mailq", float64(MailHealthConfig.Zimbra.Queue_Limit), float64(MailHealthConfig.Zimbra.Queue_Clear))
+
+    if queueThreshold.State(float64(count)) {
         common.AlarmCheckDown("mailq", "Mail queue is over the limit", false)
     } else {
         common.AlarmCheckUp("mailq", "Mail queue is under the limit", false)
     }
+
+    // The rate of a lower bound means nothing
+    if !truncated {
+        checkQueueRate(count)
+    }
 }
 
-func CheckSSL() {
+func CheckSSL() SSLCertInfo {
+    var info SSLCertInfo
     var mailHost string
     zmHostname, err := ExecZimbraCommand("zmhostname")
     if err != nil {
@@ -362,22 +633,31 @@ func CheckSSL() {
     }
 
     if mailHost == "" {
-        common.LogError("Mail host not found")
+        info.Error = "mail host not found"
+        common.PrintCheckFailed("SSL Certificate", info.Error)
+        return info
     }
     
+    info.Host = mailHost
+
     conn, err := tls.Dial("tcp", mailHost + ":443", &tls.Config{InsecureSkipVerify: true})
 
     if err != nil {
-        common.LogError("Error connecting to mail host: " + err.Error())
+        info.Error = "couldn't connect to " + mailHost + ": " + err.Error()
+        common.PrintCheckFailed("SSL Certificate", info.Error)
+        return info
     }
     defer conn.Close()
 
     certs := conn.ConnectionState().PeerCertificates
     if len(certs) == 0 {
-        common.LogError("No certificates found")
+        info.Error = "no certificates served on " + mailHost
+        common.PrintCheckFailed("SSL Certificate", info.Error)
+        return info
     }
     
     cert := certs[0]
+    info.NotAfter = cert.NotAfter
 
     // Get days until notAfter
     days := int(cert.NotAfter.Sub(time.Now()).Hours() / 24)
@@ -388,4 +668,9 @@ func CheckSSL() {
         common.PrettyPrintStr("SSL Certificate", true, fmt.Sprintf("expiring in %d days", days))
         common.AlarmCheckUp("sslcert", "SSL Certificate is expiring in " + fmt.Sprintf("%d days", days), false)
     }
+
+    info.DaysLeft = days
+    checkDeployedCert(&info, cert)
+
+    return info
 }
@@ -0,0 +1,136 @@
+//go:build linux
+package zimbraHealth
+
+import (
+    "errors"
+    "reflect"
+    "testing"
+    "github.com/monobilisim/monokit/common"
+)
+
+const testMailq = `-Queue ID-  --Size-- ----Arrival Time---- -Sender/Recipient-------
+4F2A31C0A2*    1234 Thu Oct 16 10:00:00  sender@example.com
+                                         rcpt@example.com
+
+A1B2C3D4E5     5678 Thu Oct 16 10:01:00  sender@example.com
+(connect to example.com[192.0.2.1]:25: Connection timed out)
+                                         rcpt@example.com
+
+-- 7 Kbytes in 2 Requests.
+`
+
+const testZmcontrolStatus = `Host mail1.example.com
+	amavis                  Running
+	antispam                Running
+	mailbox                 Stopped
+		mailboxd is not running.
+	snmp                    Running
+Host mail2.example.com
+	convertd                Running
+	service webapp          Running
+`
+
+// useRunner replaces common.Runner with runner for the test
+func useRunner(t *testing.T, runner common.CommandRunner) {
+    previous := common.Runner
+    common.Runner = runner
+    t.Cleanup(func() { common.Runner = previous })
+}
+
+func TestQueuedMessages(t *testing.T) {
+    zimbraPath = "/opt/zimbra"
+    command := "/opt/zimbra/common/sbin/mailq"
+    truncatedErr := &common.OutputTruncatedError{Command: command, Limit: 1024}
+    failedErr := errors.New("exit status 69")
+
+    tests := []struct {
+        name string
+        result common.FakeResult
+        count int
+        truncated bool
+        err error
+    }{
+        {"empty", common.FakeResult{Stdout: "Mail queue is empty\n"}, 0, false, nil},
+        {"messages", common.FakeResult{Stdout: testMailq}, 2, false, nil},
+        {"truncated", common.FakeResult{Stdout: testMailq, Err: truncatedErr}, 2, true, nil},
+        {"failed", common.FakeResult{Err: failedErr}, 0, false, failedErr},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            useRunner(t, &common.FakeRunner{Results: map[string]common.FakeResult{command: test.result}})
+
+            count, truncated, err := queuedMessages()
+            if count != test.count || truncated != test.truncated || !errors.Is(err, test.err) {
+                t.Errorf("got %d, %t, %v, want %d, %t, %v", count, truncated, err, test.count, test.truncated, test.err)
+            }
+        })
+    }
+}
+
+func TestZmcontrolStatus(t *testing.T) {
+    zimbraPath = "/opt/zimbra"
+    zimbraProduct = productZimbra
+    command := "/bin/su zimbra -c /opt/zimbra/bin/zmcontrol status"
+
+    tests := []struct {
+        name string
+        results map[string]common.FakeResult
+        services []ServiceInfo
+        failed bool
+        kind ZimbraCmdErrorKind
+    }{
+        {
+            name: "multiple hosts",
+            results: map[string]common.FakeResult{
+                "id -u zimbra": {Stdout: "998\n"},
+                command: {Stdout: testZmcontrolStatus},
+            },
+            services: []ServiceInfo{
+                {Host: "mail1.example.com", Name: "amavis", Status: "Running"},
+                {Host: "mail1.example.com", Name: "antispam", Status: "Running"},
+                {Host: "mail1.example.com", Name: "mailbox", Status: "Stopped"},
+                {Host: "mail1.example.com", Name: "snmp", Status: "Running"},
+                {Host: "mail2.example.com", Name: "convertd", Status: "Running"},
+                {Host: "mail2.example.com", Name: "service webapp", Status: "Running"},
+            },
+        },
+        {
+            name: "no services",
+            results: map[string]common.FakeResult{
+                "id -u zimbra": {Stdout: "998\n"},
+                command: {Stdout: "Host mail1.example.com\n"},
+            },
+        },
+        {
+            name: "no zimbra user",
+            results: map[string]common.FakeResult{},
+            failed: true,
+            kind: ZimbraCmdUserNotFound,
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            zimbraUser = ""
+            useRunner(t, &common.FakeRunner{Results: test.results})
+
+            status, err := ExecZimbraCommand("zmcontrol status")
+            if test.failed {
+                var cmdErr *ZimbraCmdError
+                if !errors.As(err, &cmdErr) || cmdErr.Kind != test.kind {
+                    t.Fatalf("got error %v, want kind %v", err, test.kind)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+
+            services := parseZmcontrolStatus(status)
+            if !reflect.DeepEqual(services, test.services) {
+                t.Errorf("got %+v, want %+v", services, test.services)
+            }
+        })
+    }
+}
@@ -0,0 +1,127 @@
+//go:build linux
+package zimbraHealth
+
+import (
+    "net"
+    "time"
+    "bufio"
+    "strconv"
+    "strings"
+    "crypto/tls"
+    "github.com/monobilisim/monokit/common"
+)
+
+var defaultMailPorts = []int{25, 587, 993, 995, 443}
+
+// Ports that speak TLS right away, the rest are plaintext until STARTTLS
+var implicitTlsPorts = []int{443, 465, 993, 995}
+
+// Ports that do not send a greeting banner
+var noBannerPorts = []int{80, 443}
+
+type MailPortsInfo struct {
+    Host string
+    Port int
+    Reachable bool
+    Banner string
+    Error string
+}
+
+func containsPort(ports []int, port int) bool {
+    for _, p := range ports {
+        if p == port {
+            return true
+        }
+    }
+    return false
+}
+
+// checkMailPort dials host:port and reads the greeting banner if asked to
+func checkMailPort(host string, port int, banner bool, timeout time.Duration) MailPortsInfo {
+    info := MailPortsInfo{Host: host, Port: port}
+    address := net.JoinHostPort(host, strconv.Itoa(port))
+
+    var conn net.Conn
+    var err error
+
+    dialer := &net.Dialer{Timeout: timeout}
+
+    if containsPort(implicitTlsPorts, port) {
+        // Only reachability is checked here, certificates are checked separately
+        conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{InsecureSkipVerify: true})
+    } else {
+        conn, err = dialer.Dial("tcp", address)
+    }
+
+    if err != nil {
+        info.Error = err.Error()
+        return info
+    }
+
+    defer conn.Close()
+
+    info.Reachable = true
+
+    if !banner || containsPort(noBannerPorts, port) {
+        return info
+    }
+
+    conn.SetReadDeadline(time.Now().Add(timeout))
+
+    line, err := bufio.NewReader(conn).ReadString('\n')
+    if err != nil {
+        info.Error = "couldn't read the banner: " + err.Error()
+        return info
+    }
+
+    info.Banner = strings.TrimSpace(line)
+
+    return info
+}
+
+func CheckMailPorts() []MailPortsInfo {
+    config := MailHealthConfig.Zimbra.Mail_Ports
+
+    host := config.Host
+    if host == "" {
+        host = "127.0.0.1"
+    }
+
+    ports := config.Ports
+    if len(ports) == 0 {
+        ports = defaultMailPorts
+    }
+
+    timeout := time.Duration(config.Timeout_Ms) * time.Millisecond
+    if timeout == 0 {
+        timeout = 3 * time.Second
+    }
+
+    var infos []MailPortsInfo
+
+    for _, port := range ports {
+        info := checkMailPort(host, port, config.Banner, timeout)
+        infos = append(infos, info)
+
+        portStr := strconv.Itoa(port)
+        service := "mail_port_" + portStr
+
+        if info.Reachable {
+            value := "reachable"
+            if info.Banner != "" {
+                value += " (" + info.Banner + ")"
+            }
+            common.PrettyPrintStr("Port " + portStr, true, value)
+            common.AlarmCheckUp(service, "Port " + portStr + " on " + host + " is reachable again", false)
+        } else {
+            common.PrettyPrintStr("Port " + portStr, false, "reachable")
+            common.AlarmCheckDown(service, "Port " + portStr + " on " + host + " is not reachable: " + info.Error, false)
+        }
+
+        if info.Reachable && info.Error != "" {
+            common.PrintCheckFailed("Port " + portStr + " banner", info.Error)
+        }
+    }
+
+    return infos
+}
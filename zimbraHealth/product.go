@@ -0,0 +1,93 @@
+//go:build linux
+package zimbraHealth
+
+import (
+    "os"
+    "sort"
+    "strings"
+    "github.com/monobilisim/monokit/common"
+)
+
+const (
+    productZimbra = "zimbra"
+    productCarbonio = "carbonio"
+)
+
+// zimbraProduct is the detected product, set with zimbraPath
+var zimbraProduct string
+
+// carbonioCommands are the Carbonio equivalents of the Zimbra tools, used
+// when the Zimbra named tool is not installed
+var carbonioCommands = map[string]string{
+    "zmprov": "/usr/bin/carbonio prov",
+}
+
+// detectZimbraProduct sets zimbraPath and zimbraProduct from the install
+// directory, Carbonio is installed under /opt/zextras
+func detectZimbraProduct() bool {
+    if _, err := os.Stat("/opt/zimbra"); !os.IsNotExist(err) {
+        zimbraPath = "/opt/zimbra"
+        zimbraProduct = productZimbra
+    }
+
+    if _, err := os.Stat("/opt/zextras"); !os.IsNotExist(err) {
+        zimbraPath = "/opt/zextras"
+        zimbraProduct = productCarbonio
+    }
+
+    return zimbraPath != ""
+}
+
+// zimbraToolExists reports whether the Zimbra named tool is installed
+func zimbraToolExists(tool string) bool {
+    _, err := os.Stat(zimbraPath + "/bin/" + tool)
+    return err == nil
+}
+
+// zimbraCommand returns the command line to run for command on the detected
+// product, eg. "zmprov gs host" becomes "carbonio prov gs host" on the
+// Carbonio releases that no longer ship zmprov
+func zimbraCommand(command string) string {
+    tool, args, _ := strings.Cut(command, " ")
+
+    if zimbraProduct == productCarbonio && !zimbraToolExists(tool) {
+        if mapped, ok := carbonioCommands[tool]; ok {
+            return strings.TrimSpace(mapped + " " + args)
+        }
+    }
+
+    return zimbraPath + "/bin/" + command
+}
+
+// carbonioServices returns the state of the carbonio-* systemd units, the
+// newer Carbonio releases run their services through systemd rather than
+// zmcontrol. The names are given without the carbonio- prefix like
+// zmcontrol does.
+func carbonioServices() ([]ServiceInfo, error) {
+    units, err := common.SystemdUnitsActive("carbonio-*.service")
+    if err != nil {
+        return nil, err
+    }
+
+    host, _ := os.Hostname()
+    var services []ServiceInfo
+
+    for unit, active := range units {
+        status := "Stopped"
+        if active {
+            status = "Running"
+        }
+
+        services = append(services, ServiceInfo{
+            Host: host,
+            Name: strings.TrimSuffix(strings.TrimPrefix(unit, "carbonio-"), ".service"),
+            Status: status,
+        })
+    }
+
+    sort.Slice(services, func(i, k int) bool {
+        return services[i].Name < services[k].Name
+    })
+
+    return services, nil
+}
@@ -0,0 +1,38 @@
+//go:build linux
+package zimbraHealth
+
+import (
+    "fmt"
+    "time"
+    "github.com/monobilisim/monokit/common"
+)
+
+// queueRateMaxAge is how old the previous count can be for the rate to
+// still mean something, eg. after the daemon was stopped for a while
+const queueRateMaxAge = time.Hour
+
+// checkQueueRate alarms when the queue grows faster than Queue_Rate_Limit
+// messages per minute, measured over at least a minute, before it reaches
+// the limit
+func checkQueueRate(count int) {
+    rateLimit := MailHealthConfig.Zimbra.Queue_Rate_Limit
+
+    // The baseline is kept for at least a minute, the rate of the runs more
+    // frequent than that would never be measured otherwise
+    delta, elapsed, firstRun := common.DeltaAfter("zimbraHealth", "mailq", float64(count), time.Minute)
+
+    if rateLimit <= 0 || firstRun || elapsed < time.Minute || elapsed > queueRateMaxAge {
+        return
+    }
+
+    rate := delta / elapsed.Minutes()
+    rateStr := fmt.Sprintf("%.1f/min", rate)
+
+    if rate > rateLimit {
+        common.PrettyPrintStr("Queue growth", false, rateStr + " (limit " + fmt.Sprintf("%.1f/min", rateLimit) + ")")
+        common.AlarmCheckDown("mailq_rate", "Mail queue is growing fast - " + rateStr + ", " + fmt.Sprint(count) + " queued", false)
+    } else {
+        common.PrettyPrintStr("Queue growth", true, rateStr)
+        common.AlarmCheckUp("mailq_rate", "Mail queue is no longer growing fast - " + rateStr + ", " + fmt.Sprint(count) + " queued", false)
+    }
+}
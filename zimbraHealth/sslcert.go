@@ -0,0 +1,70 @@
+//go:build linux
+package zimbraHealth
+
+import (
+    "os"
+    "time"
+    "errors"
+    "crypto/x509"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/pem"
+    "github.com/monobilisim/monokit/common"
+)
+
+type SSLCertInfo struct {
+    Host string
+    NotAfter time.Time
+    DaysLeft int
+    ServedFingerprint string
+    DeployedFingerprint string
+    ServedMatchesDeployed bool
+    Error string
+}
+
+func certFingerprint(cert *x509.Certificate) string {
+    sum := sha256.Sum256(cert.Raw)
+    return hex.EncodeToString(sum[:])
+}
+
+// deployedCert reads the certificate zmcertmgr deploycrt installed, the
+// first one in the file is the server certificate, the rest is the chain
+func deployedCert() (*x509.Certificate, error) {
+    path := zimbraPath + "/ssl/" + zimbraProduct + "/server/server.crt"
+
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+
+    block, _ := pem.Decode(data)
+    if block == nil {
+        return nil, errors.New("no PEM block found in " + path)
+    }
+
+    return x509.ParseCertificate(block.Bytes)
+}
+
+// checkDeployedCert alarms when the certificate served on 443 is not the
+// deployed one, the services weren't restarted after the certificate was
+// renewed or the deployment failed.
+func checkDeployedCert(info *SSLCertInfo, served *x509.Certificate) {
+    deployed, err := deployedCert()
+    if err != nil {
+        common.PrintCheckFailed("Served certificate", "couldn't read the deployed certificate: " + err.Error())
+        return
+    }
+
+    info.ServedFingerprint = certFingerprint(served)
+    info.DeployedFingerprint = certFingerprint(deployed)
+    info.ServedMatchesDeployed = info.ServedFingerprint == info.DeployedFingerprint
+
+    if info.ServedMatchesDeployed {
+        common.PrettyPrintStr("Served certificate", true, "the deployed one")
+        common.AlarmCheckUp("sslcert_deployed", "The served SSL certificate is the deployed one again", false)
+        return
+    }
+
+    common.PrettyPrintStr("Served certificate", false, "the deployed one")
+    common.AlarmCheckDown("sslcert_deployed", "The SSL certificate served on " + info.Host + " (valid until " + common.FormatTime(served.NotAfter) + ") is not the deployed one (valid until " + common.FormatTime(deployed.NotAfter) + "), a restart is pending or the deployment failed", false)
+}
@@ -0,0 +1,131 @@
+//go:build linux
+package zimbraHealth
+
+import (
+    "fmt"
+    "errors"
+    "time"
+    "context"
+    "github.com/monobilisim/monokit/common"
+)
+
+// zmfixpermsStateVersion is the schema version of the zmfixperms state
+const zmfixpermsStateVersion = 1
+
+func zmfixpermsStatePath() string {
+    return common.TmpDir + "/zmfixperms.json"
+}
+
+// zmfixpermsRuns returns the zmfixperms runs of the last 24 hours
+func zmfixpermsRuns() []time.Time {
+    var runs []time.Time
+
+    var saved []time.Time
+    if !common.LoadCache(zmfixpermsStatePath(), zmfixpermsStateVersion, &saved) {
+        return runs
+    }
+
+    for _, run := range saved {
+        if time.Since(run) < 24 * time.Hour {
+            runs = append(runs, run)
+        }
+    }
+
+    return runs
+}
+
+// destructiveActionAllowed reports whether zimbra.allow_destructive_actions
+// is set, alarming that action was skipped otherwise. Nothing is allowed in
+// collect-only mode.
+func destructiveActionAllowed(action string) bool {
+    if common.CollectOnlyMode {
+        common.Println(common.Blue + "Collect-only mode, not going to " + action + common.Reset)
+        return false
+    }
+
+    if MailHealthConfig.Zimbra.Allow_Destructive_Actions {
+        return true
+    }
+
+    common.PrettyPrintStr("Destructive actions", false, "allowed")
+    common.Alarm("[" + common.ScriptName + " - " + common.Config.Identifier + "] [:warning:] Would " + action + ", but destructive actions are disabled", "", "", false)
+    common.Audit(action, "zimbra", errors.New("skipped, destructive actions are disabled"))
+
+    return false
+}
+
+// Zmfixperms stops Zimbra, fixes the file permissions and starts it again.
+// It runs once per day at the configured schedule, or on the first run after
+// it within Catch_Up_Hours if that was missed, and at most Max_Per_Day times
+// in 24 hours.
+func Zmfixperms() {
+    config := MailHealthConfig.Zimbra.Zmfixperms
+
+    if !config.Enabled {
+        return
+    }
+
+    schedule := config.Schedule
+    if schedule == "" {
+        schedule = "03:00"
+    }
+
+    maxPerDay := config.Max_Per_Day
+    if maxPerDay == 0 {
+        maxPerDay = 1
+    }
+
+    catchUpHours := config.Catch_Up_Hours
+    if catchUpHours == 0 {
+        catchUpHours = 2
+    }
+
+    if !common.ScheduleDueWithin("zmfixperms", schedule, time.Duration(catchUpHours * float64(time.Hour))) {
+        return
+    }
+
+    // The slot is taken even if the daily cap skips it
+    common.ScheduleDone("zmfixperms")
+
+    runs := zmfixpermsRuns()
+
+    if len(runs) >= maxPerDay {
+        common.LogError(fmt.Sprintf("zmfixperms already ran %d times in the last 24 hours, skipping", len(runs)))
+        return
+    }
+
+    common.SplitSection("Fixing Permissions:")
+
+    if !destructiveActionAllowed("run zmfixperms, restarting all Zimbra services") {
+        return
+    }
+
+    common.Alarm("[" + common.ScriptName + " - " + common.Config.Identifier + "] [:warning:] Running zmfixperms, all Zimbra services will be restarted", "", "", false)
+
+    runs = append(runs, time.Now())
+    if err := common.SaveCache(zmfixpermsStatePath(), zmfixpermsStateVersion, runs); err != nil {
+        common.LogError("Error writing zmfixperms state: " + err.Error())
+    }
+
+    _, err := ExecZimbraCommand("zmcontrol stop")
+    common.Audit("stop services", "zimbra", err)
+    if err != nil {
+        common.LogError("Error stopping zimbra: " + err.Error())
+    }
+
+    _, stderr, err := common.Runner.Run(context.Background(), zimbraPath + "/libexec/zmfixperms", "-e", "-v")
+    common.Audit("fix permissions", zimbraPath, err)
+    if err != nil {
+        common.LogError("Error running zmfixperms: " + err.Error() + "\n" + stderr)
+        common.PrettyPrintStr("zmfixperms", false, "completed")
+    } else {
+        common.PrettyPrintStr("zmfixperms", true, "completed")
+    }
+
+    _, err = ExecZimbraCommand("zmcontrol start")
+    common.Audit("start services", "zimbra", err)
+    if err != nil {
+        common.LogError("Error starting zimbra: " + err.Error())
+        common.Alarm("[" + common.ScriptName + " - " + common.Config.Identifier + "] [:red_circle:] Couldn't start Zimbra after zmfixperms: " + err.Error(), "", "", false)
+    }
+}